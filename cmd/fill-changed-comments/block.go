@@ -0,0 +1,123 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	blockOpenRegexp  = regexp.MustCompile(`^([\t ]*)(/\*+)([^\n]*)`)
+	blockCloseRegexp = regexp.MustCompile(`^(.*?)[\t ]*(\*+/)$`)
+	gutterRegexp     = regexp.MustCompile(`^([\t ]*\*)([\t ].*)?$`)
+	indentRegexp     = regexp.MustCompile(`^[\t ]*`)
+)
+
+func blockClosed(lines []string) bool {
+	last := lines[len(lines)-1]
+	if len(lines) == 1 {
+		last = last[strings.Index(last, "/*")+2:]
+	}
+	return strings.Contains(last, "*/")
+}
+
+type blockComment struct {
+	opener, gutter, closer string
+	openerAlone            bool
+	closerLine             string
+	paragraphs             []paragraph
+}
+
+func parseBlockComment(lines []string) (blockComment, bool) {
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	m := blockOpenRegexp.FindStringSubmatch(texts[0])
+	if m == nil {
+		return blockComment{}, false
+	}
+	c := blockComment{opener: m[1] + m[2]}
+	texts[0] = m[3]
+	last := len(texts) - 1
+	mc := blockCloseRegexp.FindStringSubmatch(texts[last])
+	if mc == nil {
+		return blockComment{}, false
+	}
+	c.closer = mc[2]
+	if last > 0 && strings.TrimSpace(mc[1]) == "" {
+		c.closerLine = texts[last]
+		texts = texts[:last]
+	} else {
+		texts[last] = mc[1]
+	}
+	var body []string
+	indent := ""
+	for i, t := range texts {
+		if strings.Contains(t, "*/") {
+			return blockComment{}, false
+		}
+		if i > 0 && !gutterRegexp.MatchString(t) && strings.TrimSpace(t) != "" {
+			indent = indentRegexp.FindString(t)
+			break
+		}
+	}
+	for i, t := range texts {
+		if i == 0 {
+			body = append(body, strings.TrimSpace(t))
+			continue
+		}
+		if mg := gutterRegexp.FindStringSubmatch(t); mg != nil {
+			if c.gutter == "" {
+				c.gutter = mg[1] + " "
+			}
+			body = append(body, trimSeparator(mg[2]))
+			continue
+		}
+		if c.gutter == "" {
+			c.gutter = indent
+		}
+		if strings.HasPrefix(t, indent) {
+			body = append(body, t[len(indent):])
+		} else {
+			body = append(body, strings.TrimLeftFunc(t, unicode.IsSpace))
+		}
+	}
+	if c.gutter == "" {
+		if c.closerLine != "" && strings.HasPrefix(c.closer, "*") {
+			c.gutter = indentRegexp.FindString(c.closerLine) + "* "
+		} else {
+			c.gutter = m[1] + strings.Repeat(" ", len(m[2])+1)
+		}
+	}
+	c.openerAlone = body[0] == ""
+	if c.openerAlone {
+		body = body[1:]
+	}
+	c.paragraphs = parseParagraphs(body)
+	if !hasText(c.paragraphs) {
+		return blockComment{}, false
+	}
+	return c, true
+}
+
+func (st style) rewriteBlockComment(lines []string, rg region) []string {
+	c, _ := parseBlockComment(normalize(lines))
+	first := c.opener + " "
+	source := lines
+	lines = nil
+	if c.openerAlone {
+		lines = append(lines, c.opener+"\n")
+		first = c.gutter
+		source, rg = source[1:], rg.sub(1)
+	}
+	suffix := c.closer
+	if c.closerLine != "" {
+		suffix = ""
+	}
+	lines = append(lines, st.fillParagraphs(c.paragraphs, first, c.gutter, suffix, source, rg)...)
+	if c.closerLine != "" {
+		lines = append(lines, c.closerLine+"\n")
+	}
+	return lines
+}
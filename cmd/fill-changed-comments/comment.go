@@ -0,0 +1,188 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	fenceRegexp     = regexp.MustCompile("^[\t ]*(?:```|~~~)")
+	listItemRegexp  = regexp.MustCompile(`^([\t ]*)((?:[-*+]|[0-9]+[.)])[\t ]+)[^\t ]`)
+	startRegexp     = regexp.MustCompile(`^(?:@|(?:BUG|FIXME|NOTE|TODO|XXX)(?:\([^)]*\))?:)`)
+	preformatRegexp = regexp.MustCompile(`^(?:[\t ]|#|\|)`)
+)
+
+// A paragraph is either lines to keep as they are or text to fill. The text of
+// a list item starts with its marker, and later lines hang under the text.
+// Start and stop index the contents that the paragraph came from.
+type paragraph struct {
+	verbatim     bool
+	lines        []string
+	indent, hang string
+	start, stop  int
+}
+
+func (p paragraph) isItem() bool {
+	return !p.verbatim && p.hang != p.indent
+}
+
+// The contents are the comment lines without their comment markers. Indented
+// lines, headings and table rows are preformatted, as are lines inside fences.
+func parseParagraphs(contents []string) []paragraph {
+	var ps []paragraph
+	fenced := false
+	for i, t := range contents {
+		n := len(ps)
+		m := listItemRegexp.FindStringSubmatch(t)
+		switch {
+		case fenced || fenceRegexp.MatchString(t):
+			if fenceRegexp.MatchString(t) {
+				fenced = !fenced
+			}
+			ps = append(ps, paragraph{verbatim: true, lines: []string{t}})
+		case strings.TrimSpace(t) == "":
+			ps = append(ps, paragraph{verbatim: true, lines: []string{""}})
+		case m == nil && n > 0 && ps[n-1].isItem() && isContinuation(t, ps[n-1].hang):
+			ps[n-1].lines = append(ps[n-1].lines, t[len(ps[n-1].hang):])
+		case m == nil && preformatRegexp.MatchString(t):
+			ps = append(ps, paragraph{verbatim: true, lines: []string{t}})
+		case m != nil:
+			ps = append(ps, paragraph{
+				lines:  []string{t[len(m[1]):]},
+				indent: m[1],
+				hang:   m[1] + strings.Repeat(" ", len(m[2])),
+			})
+		case n == 0 || ps[n-1].verbatim || startRegexp.MatchString(t):
+			ps = append(ps, paragraph{lines: []string{t}})
+		default:
+			ps[n-1].lines = append(ps[n-1].lines, t)
+		}
+		if len(ps) > n {
+			ps[n].start = i
+		}
+		ps[len(ps)-1].stop = i + 1
+	}
+	return ps
+}
+
+// A tab after a comment marker is part of the text, but a space is not.
+func trimSeparator(t string) string {
+	return strings.TrimPrefix(t, " ")
+}
+
+// Continuation lines line up with the text of the item. Lines indented further
+// are preformatted.
+func isContinuation(t, hang string) bool {
+	return strings.HasPrefix(t, hang) && !preformatRegexp.MatchString(t[len(hang):])
+}
+
+func hasText(ps []paragraph) bool {
+	for _, p := range ps {
+		if !p.verbatim {
+			return true
+		}
+		for _, t := range p.lines {
+			if strings.TrimSpace(t) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Paragraphs outside of the region keep their source lines. The suffix, if any,
+// goes at the end of the last line.
+func (st style) fillParagraphs(ps []paragraph, first, rest, suffix string, source []string, rg region) []string {
+	var lines []string
+	prefix := first
+	for i, p := range ps {
+		last := i == len(ps)-1
+		if !rg.overlaps(p.start, p.stop) {
+			lines = append(lines, source[p.start:p.stop]...)
+			prefix = rest
+			continue
+		}
+		if p.verbatim {
+			for j, t := range p.lines {
+				line := prefix + t
+				if strings.HasPrefix(t, "\t") {
+					line = strings.TrimSuffix(prefix, " ") + t
+				}
+				if last && j == len(p.lines)-1 && suffix != "" {
+					line = strings.TrimRightFunc(line, unicode.IsSpace) + " " + suffix
+				}
+				lines = append(lines, strings.TrimRightFunc(line, unicode.IsSpace)+"\n")
+				prefix = rest
+			}
+			continue
+		}
+		rg.refilled(p.start, p.stop)
+		words := splitWords(strings.Join(p.lines, " "))
+		if last && suffix != "" {
+			words[len(words)-1] += " " + suffix
+		}
+		lines = append(lines, st.fill(words, prefix+p.indent, rest+p.hang)...)
+		prefix = rest
+	}
+	return lines
+}
+
+// Code spans are single words, as in Markdown.
+func splitWords(s string) []string {
+	var words []string
+	start := -1
+	for i := 0; i < len(s); {
+		if s[i] == '`' {
+			n := backticks(s[i:])
+			if start < 0 {
+				start = i
+			}
+			if j := closingBackticks(s[i+n:], n); j >= 0 {
+				i += n + j + n
+			} else {
+				i += n
+			}
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				words = append(words, s[start:i])
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+		i += size
+	}
+	if start >= 0 {
+		words = append(words, s[start:])
+	}
+	return words
+}
+
+func backticks(s string) int {
+	n := 0
+	for n < len(s) && s[n] == '`' {
+		n++
+	}
+	return n
+}
+
+func closingBackticks(s string, n int) int {
+	for i := 0; i < len(s); {
+		j := strings.IndexByte(s[i:], '`')
+		if j < 0 {
+			return -1
+		}
+		i += j
+		m := backticks(s[i:])
+		if m == n {
+			return i
+		}
+		i += m
+	}
+	return -1
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Directives are comments that tools read, matched against the text after the
+// comment marker. Comments with directives are never touched, and neither is
+// anything from a format off directive to the next format on directive.
+var (
+	directives = []string{
+		`[Nn]ext(?:(?:[\t ]+available)?[\t ]+(?:id|tag))?:[\t ]+\d+[\t ]*\n?$`,
+		`go:[a-z]`,
+		`\+build[\t ]`,
+		`nolint`,
+		`NOLINT`,
+		`lint:(?:ignore|file-ignore)`,
+		`type:[\t ]*ignore`,
+		`noqa`,
+		`pylint:[\t ]*(?:disable|enable)`,
+		`mypy:`,
+		`pragma:`,
+		`eslint(?:-|[\t ])`,
+		`prettier-ignore`,
+		`@ts-(?:check|expect-error|ignore|nocheck)`,
+		`istanbul[\t ]+ignore`,
+		`shellcheck[\t ]`,
+		`SPDX-`,
+		`-\*-.*-\*-`,
+		`vim?:`,
+	}
+	formatOffDirectives = []string{
+		`clang-format[\t ]+off`,
+		`fmt:[\t ]*off`,
+		`@formatter:off`,
+		`yapf:[\t ]*disable`,
+	}
+	formatOnDirectives = []string{
+		`clang-format[\t ]+on`,
+		`fmt:[\t ]*on`,
+		`@formatter:on`,
+		`yapf:[\t ]*enable`,
+	}
+)
+
+func compileDirectives(markers string, directives []string) *regexp.Regexp {
+	return regexp.MustCompile(`^[\t ]*` + markers + `[\t ]*(?:` + strings.Join(directives, "|") + `)`)
+}
+
+// The comments in line may follow code.
+func (st style) hasDirective(re *regexp.Regexp, line string) bool {
+	for _, loc := range st.lang.tokenRegexp.FindAllStringIndex(line, -1) {
+		if re.MatchString(line[loc[0]:loc[1]]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (st style) hasAnyDirective(lines []string) bool {
+	for _, line := range lines {
+		if st.lang.directiveRegexp.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
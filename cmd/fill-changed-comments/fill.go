@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"strings"
+)
+
+const (
+	greedyFill = iota
+	optimalFill
+)
+
+var fillMode = choice{names: []string{"greedy", "optimal"}}
+
+func init() {
+	flag.Var(&fillMode, "fill", "break lines by `method`: greedy puts as many words as fit on each line, optimal evens out the lines")
+}
+
+func (st style) fill(words []string, first, rest string) []string {
+	words = punctuate(words)
+	gaps := gaps(words)
+	var breaks []int
+	if fillMode.index == optimalFill {
+		breaks = st.optimalBreaks(words, gaps, first, rest)
+	} else {
+		breaks = st.greedyBreaks(words, gaps, first, rest)
+	}
+	var lines []string
+	i := 0
+	for k, j := range breaks {
+		var b strings.Builder
+		if k == 0 {
+			_, _ = b.WriteString(first)
+		} else {
+			_, _ = b.WriteString(rest)
+		}
+		for l := i; l < j; l++ {
+			if l > i {
+				_, _ = b.WriteString(gaps[l])
+			}
+			_, _ = b.WriteString(words[l])
+		}
+		_, _ = b.WriteRune('\n')
+		lines = append(lines, b.String())
+		i = j
+	}
+	return lines
+}
+
+// Each break is the index of the word after a line.
+func (st style) greedyBreaks(words, gaps []string, first, rest string) []int {
+	var breaks []int
+	for i, prefix := 0, first; i < len(words); prefix = rest {
+		j := i
+		for col := st.advanceString(0, prefix); j < len(words); j++ {
+			if j > i {
+				col = st.advanceString(col, gaps[j])
+			}
+			col = st.advanceString(col, words[j])
+			if col > st.maxCol {
+				break
+			}
+		}
+		if j == i {
+			j++
+		}
+		breaks = append(breaks, j)
+		i = j
+	}
+	return breaks
+}
+
+// Minimize the sum of the squared slack of the lines, as Knuth and Plass do
+// without stretchable spaces. The last line is free unless it is a lone word.
+func (st style) optimalBreaks(words, gaps []string, first, rest string) []int {
+	n := len(words)
+	cost := make([]uint64, n+1)
+	from := make([]int, n+1)
+	for j := 1; j <= n; j++ {
+		cost[j] = math.MaxUint64
+	}
+	for i := 0; i < n; i++ {
+		prefix := rest
+		if i == 0 {
+			prefix = first
+		}
+		col := st.advanceString(0, prefix)
+		for j := i; j < n; j++ {
+			if j > i {
+				col = st.advanceString(col, gaps[j])
+			}
+			col = st.advanceString(col, words[j])
+			if col > st.maxCol && j > i {
+				break
+			}
+			var c uint64
+			if col < st.maxCol && (j+1 < n || j == i && i > 0) {
+				slack := st.maxCol - col
+				c = slack * slack
+			}
+			if cost[i]+c < cost[j+1] {
+				cost[j+1] = cost[i] + c
+				from[j+1] = i
+			}
+		}
+	}
+	var breaks []int
+	for j := n; j > 0; j = from[j] {
+		breaks = append(breaks, j)
+	}
+	for i, j := 0, len(breaks)-1; i < j; i, j = i+1, j-1 {
+		breaks[i], breaks[j] = breaks[j], breaks[i]
+	}
+	return breaks
+}
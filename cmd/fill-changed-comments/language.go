@@ -0,0 +1,132 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	generalComment = `/\*(?:[^*]|\*+[^*/])*(?:$|\*+(?:$|/))`
+	runeLiteral    = `'(?:[^\n'\\]|\\[^\n])*(?:$|\\$|')`
+	rawString      = "`[^`]*(?:$|`)"
+	stringLiteral  = `"(?:[^\n"\\]|\\[^\n])*(?:$|\\$|")`
+	shellString    = `'[^\n']*(?:$|')`
+	sqlString      = `'(?:[^\n']|'')*(?:$|')`
+)
+
+// The line comment markers are regular expressions.
+type syntax struct {
+	lineComments  []string
+	blockComments bool
+	literals      []string
+}
+
+var (
+	cSyntax     = syntax{[]string{`//`}, true, []string{runeLiteral, stringLiteral}}
+	goSyntax    = syntax{[]string{`//`}, true, []string{runeLiteral, rawString, stringLiteral}}
+	hashSyntax  = syntax{[]string{`#`}, false, []string{runeLiteral, stringLiteral}}
+	shellSyntax = syntax{[]string{`#`}, false, []string{shellString, stringLiteral}}
+	sqlSyntax   = syntax{[]string{`--`}, true, []string{sqlString, stringLiteral}}
+	dashSyntax  = syntax{[]string{`--`}, false, []string{stringLiteral}}
+	lispSyntax  = syntax{[]string{`;+`}, false, []string{stringLiteral}}
+	texSyntax   = syntax{[]string{`%+`}, false, nil}
+	otherSyntax = syntax{[]string{`#`, `//`}, false, []string{runeLiteral, rawString, stringLiteral}}
+)
+
+// Keys are extensions or, for files like Makefile, base names.
+var syntaxes = map[string]syntax{
+	".c":         cSyntax,
+	".cc":        cSyntax,
+	".cpp":       cSyntax,
+	".cs":        cSyntax,
+	".cxx":       cSyntax,
+	".h":         cSyntax,
+	".hh":        cSyntax,
+	".hpp":       cSyntax,
+	".java":      cSyntax,
+	".js":        cSyntax,
+	".jsx":       cSyntax,
+	".kt":        cSyntax,
+	".proto":     cSyntax,
+	".rs":        cSyntax,
+	".scala":     cSyntax,
+	".swift":     cSyntax,
+	".ts":        cSyntax,
+	".tsx":       cSyntax,
+	".go":        goSyntax,
+	".bzl":       hashSyntax,
+	".cmake":     hashSyntax,
+	".mk":        hashSyntax,
+	".pl":        hashSyntax,
+	".py":        hashSyntax,
+	".r":         hashSyntax,
+	".rb":        hashSyntax,
+	".toml":      hashSyntax,
+	".yaml":      hashSyntax,
+	".yml":       hashSyntax,
+	"BUILD":      hashSyntax,
+	"Dockerfile": hashSyntax,
+	"Makefile":   hashSyntax,
+	".bash":      shellSyntax,
+	".sh":        shellSyntax,
+	".zsh":       shellSyntax,
+	".sql":       sqlSyntax,
+	".hs":        dashSyntax,
+	".lua":       dashSyntax,
+	".clj":       lispSyntax,
+	".el":        lispSyntax,
+	".lisp":      lispSyntax,
+	".scm":       lispSyntax,
+	".bib":       texSyntax,
+	".cls":       texSyntax,
+	".sty":       texSyntax,
+	".tex":       texSyntax,
+}
+
+type language struct {
+	blockComments     bool
+	lineCommentRegexp *regexp.Regexp
+	tokenRegexp       *regexp.Regexp
+	directiveRegexp   *regexp.Regexp
+	formatOffRegexp   *regexp.Regexp
+	formatOnRegexp    *regexp.Regexp
+}
+
+func (s syntax) compile() *language {
+	markers := "(?:" + strings.Join(s.lineComments, "|") + ")"
+	tokens := []string{markers + `[^\n]*`}
+	anyMarkers := markers
+	if s.blockComments {
+		tokens = append(tokens, generalComment)
+		anyMarkers = "(?:" + markers + `|/\*+|\*)`
+	}
+	return &language{
+		blockComments:     s.blockComments,
+		lineCommentRegexp: regexp.MustCompile(`^([\t ]*` + markers + `)((?:[\t ][^\n]*)?)\n?$`),
+		tokenRegexp:       regexp.MustCompile(strings.Join(append(tokens, s.literals...), "|")),
+		directiveRegexp:   compileDirectives(anyMarkers, append(append(directives, formatOffDirectives...), formatOnDirectives...)),
+		formatOffRegexp:   compileDirectives(anyMarkers, formatOffDirectives),
+		formatOnRegexp:    compileDirectives(anyMarkers, formatOnDirectives),
+	}
+}
+
+var languages = func() map[string]*language {
+	m := make(map[string]*language, len(syntaxes))
+	for key, s := range syntaxes {
+		m[key] = s.compile()
+	}
+	return m
+}()
+
+var otherLanguage = otherSyntax.compile()
+
+func languageFor(path string) *language {
+	if l, ok := languages[filepath.Base(path)]; ok {
+		return l
+	}
+	if l, ok := languages[strings.ToLower(filepath.Ext(path))]; ok {
+		return l
+	}
+	return otherLanguage
+}
@@ -2,55 +2,33 @@ package main
 
 import (
 	"bufio"
-	"bytes"
+	"flag"
 	"io"
 	"log"
-	"os"
-	"regexp"
 	"strings"
 	"unicode"
 
 	"github.com/eisenstatdavid/tools/internal/diff"
+	"github.com/eisenstatdavid/tools/internal/driver"
 	"github.com/eisenstatdavid/tools/internal/numbers"
-	"github.com/eisenstatdavid/tools/internal/rewrite"
 	"github.com/eisenstatdavid/tools/internal/scanner"
 )
 
-const maxCol = 80
-
 func main() {
-	diffs, err := diff.Parse(os.Stdin)
-	if err != nil {
-		log.Fatal(err)
-	}
-	fail := false
-	for _, d := range diffs {
-		if d.DstPath == os.DevNull {
-			continue
-		}
-		if err := rewrite.File(d.DstPath, func(r io.Reader, w io.Writer) error {
-			return rewriteChangedLines(d.DstChanges, r, w)
-		}); err != nil {
-			log.Print(err)
-			fail = true
-		}
-	}
-	if fail {
-		os.Exit(1)
-	}
+	driver.Main(driver.RewriterFunc(rewriteChangedLines))
 }
 
-var (
-	lineCommentRegexp = regexp.MustCompile(`^([\t ]*(?:#|//))([\t ][^\n]*)`)
-	nextCommentRegexp = regexp.MustCompile(`^[\t ]*//[\t ]*[Nn]ext(?:(?:[\t ]+available)?(?:[\t ]+)(?:id|tag))?:[\t ]+\d+[\t ]*\n$`)
-	listRegexp        = regexp.MustCompile(`^[\t ]*// (?:[-*]|[0-9]\.) `)
-)
+var verbose = flag.Bool("v", false, "report each refilled paragraph")
 
-func isFillableLineComment(t string) bool {
-	return lineCommentRegexp.MatchString(t) && !nextCommentRegexp.MatchString(t) && !listRegexp.MatchString(t)
+func (st style) isFillableLineComment(t string) bool {
+	return st.lang.lineCommentRegexp.MatchString(t) && !st.lang.directiveRegexp.MatchString(t)
 }
 
-func rewriteChangedLines(changes []diff.Interval, r io.Reader, w io.Writer) error {
+func rewriteChangedLines(path string, changes []diff.Interval, r io.Reader, w io.Writer) error {
+	st, err := styleFor(path)
+	if err != nil {
+		return err
+	}
 	bw := bufio.NewWriter(w)
 	s := scanner.Make(r)
 	i := 0
@@ -58,25 +36,54 @@ func rewriteChangedLines(changes []diff.Interval, r io.Reader, w io.Writer) erro
 		for i < len(changes) && changes[i].Stop <= s.Line() {
 			i++
 		}
-		lines := []string{s.Text()}
-		rewrite := rewriteCode
+		first, lines := s.Line(), []string{s.Text()}
+		rewrite := st.rewriteCode
+		var fill func([]string, region) []string
 		t := s.Text()
-		if isFillableLineComment(t) {
-			rewrite = rewriteComment
+		if st.hasDirective(st.lang.formatOffRegexp, t) {
+			rewrite = nil
+			for !st.hasDirective(st.lang.formatOnRegexp, lines[len(lines)-1]) && s.Scan() {
+				lines = append(lines, s.Text())
+			}
+		} else if st.lang.directiveRegexp.MatchString(t) && !blockOpenRegexp.MatchString(t) {
+			rewrite = nil
+		} else if st.isFillableLineComment(t) {
+			fill = st.rewriteComment
 			for s.Scan() {
 				t := s.Text()
-				if !isFillableLineComment(t) {
+				if !st.isFillableLineComment(t) {
+					s.Unscan()
+					break
+				}
+				lines = append(lines, s.Text())
+			}
+		} else if st.lang.blockComments && blockOpenRegexp.MatchString(t) {
+			for !blockClosed(lines) && s.Scan() {
+				lines = append(lines, s.Text())
+			}
+			if st.hasAnyDirective(lines) {
+				rewrite = nil
+			} else if _, ok := parseBlockComment(lines); ok {
+				fill = st.rewriteBlockComment
+			} else {
+				fill = st.rewriteChangedCode
+			}
+		} else if trailing.index == alignTrailing && st.hasTrailingComment(t) {
+			rewrite = st.alignTrailingComments
+			for s.Scan() {
+				if !st.hasTrailingComment(s.Text()) || indentRegexp.FindString(s.Text()) != indentRegexp.FindString(t) {
 					s.Unscan()
 					break
 				}
 				lines = append(lines, s.Text())
 			}
 		}
-		if i < len(changes) && s.Line() >= changes[i].Start {
-			for j, line := range lines {
-				lines[j] = numbers.Normalize(line)
+		if rg := (region{path, first, changes[i:]}); rg.overlaps(0, len(lines)) {
+			if fill != nil {
+				lines = fill(lines, rg)
+			} else if rewrite != nil {
+				lines = rewrite(normalize(lines))
 			}
-			lines = rewrite(lines)
 		}
 		for _, line := range lines {
 			if _, err := bw.WriteString(line); err != nil {
@@ -90,72 +97,87 @@ func rewriteChangedLines(changes []diff.Interval, r io.Reader, w io.Writer) erro
 	return bw.Flush()
 }
 
-var tokenRegexp = regexp.MustCompile(strings.Join([]string{
-	`(?:#|//)[^\n]*`,                        // line comment
-	`/\*(?:[^*]|\*+[^*/])*(?:$|\*+(?:$|/))`, // general comment
-	`'(?:[^\n'\\]|\\[^\n])*(?:$|\\$|')`,     // rune literal
-	"`[^`]*(?:$|`)",                         // raw string literal
-	`"(?:[^\n"\\]|\\[^\n])*(?:$|\\$|")`,     // interpreted string literal
-}, "|"))
+// A region locates a comment in the file and reports the paragraphs of the
+// comment that it refills. Lines are numbered from zero within the region.
+type region struct {
+	path    string
+	first   uint64
+	changes []diff.Interval
+}
+
+// A deletion overlaps the lines around it.
+func (rg region) overlaps(start, stop int) bool {
+	for _, c := range rg.changes {
+		if c.Start < rg.first+uint64(stop) && rg.first+uint64(start) < c.Stop {
+			return true
+		}
+	}
+	return false
+}
+
+func (rg region) sub(offset int) region {
+	rg.first += uint64(offset)
+	return rg
+}
 
-func rewriteCode(lines []string) []string {
+func (rg region) refilled(start, stop int) {
+	if *verbose {
+		log.Printf("%s:%d-%d: refilled paragraph", rg.path, rg.first+uint64(start), rg.first+uint64(stop)-1)
+	}
+}
+
+func normalize(lines []string) []string {
+	result := make([]string, len(lines))
 	for i, line := range lines {
-		lines[i] = tokenRegexp.ReplaceAllStringFunc(
+		result[i] = numbers.Normalize(line)
+	}
+	return result
+}
+
+func (st style) rewriteCode(lines []string) []string {
+	var result []string
+	for _, line := range lines {
+		line = st.lang.tokenRegexp.ReplaceAllStringFunc(
 			strings.TrimRightFunc(line, unicode.IsSpace),
 			func(tok string) string {
+				if st.lang.directiveRegexp.MatchString(tok) {
+					return tok
+				}
 				return strings.Join(strings.Fields(tok), " ")
 			}) + "\n"
+		if trailing.index == moveTrailing {
+			result = append(result, st.moveTrailingComment(line)...)
+		} else {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// Lines that are not a fillable comment are rewritten only where they changed.
+func (st style) rewriteChangedCode(lines []string, rg region) []string {
+	var result []string
+	for j, line := range lines {
+		if rg.overlaps(j, j+1) {
+			result = append(result, st.rewriteCode(normalize([]string{line}))...)
+		} else {
+			result = append(result, line)
+		}
 	}
-	return lines
+	return result
 }
 
-func rewriteComment(lines []string) []string {
+func (st style) rewriteComment(lines []string, rg region) []string {
 	var (
-		prefix string
-		words  []string
+		prefix   string
+		contents []string
 	)
-	for i, line := range lines {
-		m := lineCommentRegexp.FindStringSubmatch(line)
+	for i, line := range normalize(lines) {
+		m := st.lang.lineCommentRegexp.FindStringSubmatch(line)
 		if i == 0 {
 			prefix = m[1]
 		}
-		words = append(words, strings.Fields(m[2])...)
-	}
-	lines = nil
-	for i := 0; i < len(words); {
-		j := i
-		for col := advanceString(0, prefix); j < len(words); j++ {
-			col = advanceRune(col, ' ')
-			col = advanceString(col, words[j])
-			if col > maxCol {
-				break
-			}
-		}
-		if j == i {
-			j++
-		}
-		var b bytes.Buffer
-		_, _ = b.WriteString(prefix)
-		for ; i < j; i++ {
-			_, _ = b.WriteRune(' ')
-			_, _ = b.WriteString(words[i])
-		}
-		_, _ = b.WriteRune('\n')
-		lines = append(lines, b.String())
-	}
-	return lines
-}
-
-func advanceString(col uint64, s string) uint64 {
-	for _, r := range s {
-		col = advanceRune(col, r)
-	}
-	return col
-}
-
-func advanceRune(col uint64, r rune) uint64 {
-	if r == '\t' {
-		col |= 1
+		contents = append(contents, trimSeparator(m[2]))
 	}
-	return col + 1
+	return st.fillParagraphs(parseParagraphs(contents), prefix+" ", prefix+" ", "", lines, rg)
 }
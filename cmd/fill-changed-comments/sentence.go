@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"regexp"
+	"strings"
+)
+
+const (
+	singleSpacing = iota
+	doubleSpacing
+	frenchSpacing
+)
+
+var spacing = choice{names: []string{"single", "double", "french"}}
+
+func init() {
+	flag.Var(&spacing, "sentences", "space refilled sentences by `convention`: single, double after each sentence, or french with a space before ; : ! and ?")
+}
+
+var (
+	sentenceEndRegexp   = regexp.MustCompile(`^(.*[^.!?])?([.!?]+)['")\]]*$`)
+	sentenceStartRegexp = regexp.MustCompile(`^['"(\[]*\p{Lu}`)
+	initialismRegexp    = regexp.MustCompile(`^['"(\[]*\pL(?:\.\pL)*$`)
+	highPunctRegexp     = regexp.MustCompile(`^([^\t ]*[\pL\pN'"])([;:!?]+)$`)
+	punctRegexp         = regexp.MustCompile(`^[;:!?]+$`)
+)
+
+var abbreviations = map[string]bool{
+	"al":     true,
+	"approx": true,
+	"cf":     true,
+	"dr":     true,
+	"e.g":    true,
+	"i.e":    true,
+	"mr":     true,
+	"mrs":    true,
+	"ms":     true,
+	"no":     true,
+	"resp":   true,
+	"vs":     true,
+	"viz":    true,
+}
+
+// A period ends a sentence unless it ends an abbreviation or an initial. Either
+// way, the next sentence has to start with a capital letter.
+func endsSentence(word, next string) bool {
+	m := sentenceEndRegexp.FindStringSubmatch(word)
+	if m == nil || !sentenceStartRegexp.MatchString(next) {
+		return false
+	}
+	if m[2] != "." {
+		return true
+	}
+	return !abbreviations[strings.ToLower(strings.TrimLeft(m[1], `'"([`))] && !initialismRegexp.MatchString(m[1])
+}
+
+// French punctuation stays on the line of the word before it.
+func punctuate(words []string) []string {
+	if spacing.index != frenchSpacing {
+		return words
+	}
+	var result []string
+	for _, word := range words {
+		if n := len(result); n > 0 && punctRegexp.MatchString(word) {
+			result[n-1] += " " + word
+		} else if m := highPunctRegexp.FindStringSubmatch(word); m != nil && !strings.Contains(word, "://") {
+			result = append(result, m[1]+" "+m[2])
+		} else {
+			result = append(result, word)
+		}
+	}
+	return result
+}
+
+// The gap before each word but the first separates it from the word before.
+func gaps(words []string) []string {
+	gaps := make([]string, len(words))
+	for j := 1; j < len(words); j++ {
+		gaps[j] = " "
+		if spacing.index == doubleSpacing && endsSentence(words[j-1], words[j]) {
+			gaps[j] = strings.Repeat(" ", 2)
+		}
+	}
+	return gaps
+}
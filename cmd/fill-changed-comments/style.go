@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/eisenstatdavid/tools/internal/editorconfig"
+)
+
+var (
+	maxCol   = flag.Uint64("width", 80, "fill comments to `n` columns")
+	tabWidth = flag.Uint64("tab-width", 2, "advance to the next multiple of `n` columns at each tab")
+)
+
+var setFlags = sync.OnceValue(func() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+})
+
+// A choice is a flag that takes one of a fixed set of names.
+type choice struct {
+	names []string
+	index int
+}
+
+func (c *choice) String() string {
+	if c.names == nil {
+		return ""
+	}
+	return c.names[c.index]
+}
+
+func (c *choice) Set(s string) error {
+	for i, name := range c.names {
+		if s == name {
+			c.index = i
+			return nil
+		}
+	}
+	return fmt.Errorf("want one of %s", strings.Join(c.names, ", "))
+}
+
+type style struct {
+	maxCol, tabWidth uint64
+	lang             *language
+}
+
+// Flags given on the command line take precedence over .editorconfig files,
+// which take precedence over the defaults.
+func styleFor(path string) (style, error) {
+	st := style{*maxCol, *tabWidth, languageFor(path)}
+	properties, err := editorconfig.Lookup(path)
+	if err != nil {
+		return style{}, err
+	}
+	if n, ok := parsePositive(properties["max_line_length"]); ok && !setFlags()["width"] {
+		st.maxCol = n
+	}
+	if !setFlags()["tab-width"] {
+		if n, ok := parsePositive(properties["tab_width"]); ok {
+			st.tabWidth = n
+		} else if n, ok := parsePositive(properties["indent_size"]); ok {
+			st.tabWidth = n
+		}
+	}
+	if st.tabWidth == 0 {
+		st.tabWidth = 1
+	}
+	return st, nil
+}
+
+func parsePositive(s string) (uint64, bool) {
+	n, err := strconv.ParseUint(s, 10, 64)
+	return n, err == nil && n > 0
+}
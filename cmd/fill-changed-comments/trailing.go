@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"unicode"
+)
+
+const (
+	keepTrailing = iota
+	moveTrailing
+	alignTrailing
+)
+
+var trailing = choice{names: []string{"keep", "move", "align"}}
+
+func init() {
+	flag.Var(&trailing, "trailing", "`mode` for comments after code on changed lines: keep them, move overlong ones above the code, or align consecutive ones")
+}
+
+func (st style) splitTrailingComment(line string) (code, comment string, ok bool) {
+	for _, loc := range st.lang.tokenRegexp.FindAllStringIndex(line, -1) {
+		m := st.lang.lineCommentRegexp.FindStringSubmatch(line[loc[0]:])
+		if m == nil {
+			continue
+		}
+		code = line[:loc[0]]
+		if st.lang.directiveRegexp.MatchString(line[loc[0]:]) || strings.TrimSpace(code) == "" || strings.TrimSpace(m[2]) == "" || !strings.ContainsAny(code[len(code)-1:], "\t ") {
+			return "", "", false
+		}
+		return code, line[loc[0]:], true
+	}
+	return "", "", false
+}
+
+func (st style) hasTrailingComment(line string) bool {
+	_, _, ok := st.splitTrailingComment(line)
+	return ok
+}
+
+func (st style) moveTrailingComment(line string) []string {
+	code, comment, ok := st.splitTrailingComment(line)
+	if !ok || st.advanceString(0, strings.TrimSuffix(line, "\n")) <= st.maxCol {
+		return []string{line}
+	}
+	m := st.lang.lineCommentRegexp.FindStringSubmatch(comment)
+	prefix := indentRegexp.FindString(code) + strings.TrimSpace(m[1]) + " "
+	lines := st.fill(splitWords(m[2]), prefix, prefix)
+	return append(lines, strings.TrimRightFunc(code, unicode.IsSpace)+"\n")
+}
+
+// Like gofmt, leave one space between the longest code and its comment.
+func (st style) alignTrailingComments(lines []string) []string {
+	lines = st.rewriteCode(lines)
+	codes, comments := make([]string, len(lines)), make([]string, len(lines))
+	var col uint64
+	for i, line := range lines {
+		code, comment, _ := st.splitTrailingComment(line)
+		codes[i], comments[i] = strings.TrimRightFunc(code, unicode.IsSpace), comment
+		if c := st.advanceString(0, codes[i]); c > col {
+			col = c
+		}
+	}
+	for i := range lines {
+		pad := col + 1 - st.advanceString(0, codes[i])
+		lines[i] = codes[i] + strings.Repeat(" ", int(pad)) + comments[i]
+	}
+	return lines
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+const (
+	zeroWidthJoiner    = rune(0x200D)
+	emojiPresentation  = rune(0xFE0F)
+	firstEmojiModifier = rune(0x1F3FB)
+	lastEmojiModifier  = rune(0x1F3FF)
+	firstHangulMedial  = rune(0x1160)
+	lastHangulFinal    = rune(0x11FF)
+)
+
+// Columns are counted per grapheme cluster, approximately: combining marks,
+// emoji modifiers, and runes after a zero width joiner extend the previous
+// cluster, and an emoji presentation selector widens it.
+func (st style) advanceString(col uint64, s string) uint64 {
+	var (
+		last   uint64
+		joined bool
+	)
+	for _, r := range s {
+		switch {
+		case joined:
+			joined = false
+		case r == zeroWidthJoiner:
+			joined = true
+		case r == emojiPresentation:
+			if last == 1 {
+				col++
+				last = 2
+			}
+		case extendsCluster(r):
+		default:
+			next := st.advanceRune(col, r)
+			last = next - col
+			col = next
+		}
+	}
+	return col
+}
+
+func extendsCluster(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) ||
+		r >= firstEmojiModifier && r <= lastEmojiModifier ||
+		r >= firstHangulMedial && r <= lastHangulFinal
+}
+
+func (st style) advanceRune(col uint64, r rune) uint64 {
+	if r == '\t' {
+		return (col/st.tabWidth + 1) * st.tabWidth
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return col + 2
+	}
+	return col + 1
+}
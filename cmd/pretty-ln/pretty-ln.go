@@ -4,9 +4,12 @@ import (
 	"flag"
 	"os"
 	"path/filepath"
+
+	"github.com/eisenstatdavid/tools/internal/rewrite"
 )
 
 func main() {
+	rewrite.Flags()
 	flag.Parse()
 	for _, name := range flag.Args() {
 		ln, err := os.Readlink(name)
@@ -14,13 +17,12 @@ func main() {
 			panic(err)
 		}
 		ln = filepath.Clean(ln)
-		err = os.Symlink(filepath.Join(filepath.Dir(ln), filepath.Base(name)), name+"~")
-		if err != nil {
-			panic(err)
-		}
-		err = os.Rename(name+"~", name)
+		_, err = rewrite.Symlink(name, filepath.Join(filepath.Dir(ln), filepath.Base(name)))
 		if err != nil {
 			panic(err)
 		}
 	}
+	if rewrite.WouldChange() {
+		os.Exit(1)
+	}
 }
@@ -1,63 +1,329 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"golang.org/x/sync/semaphore"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
 	"sync"
-	"sync/atomic"
+	"time"
 
+	"github.com/eisenstatdavid/tools/internal/diff"
 	"github.com/eisenstatdavid/tools/internal/rewrite"
 )
 
-func inParallel(parallelism int, f func(string) error, args []string) int {
-	fails := uintptr(0)
-	var wg sync.WaitGroup
+type result struct {
+	changed        bool
+	stdout, stderr bytes.Buffer
+	err            error
+}
+
+type summary struct {
+	changed, unchanged, failed int
+}
+
+func inParallel(parallelism int, f func(string, io.Writer, io.Writer) (bool, error), args []string) summary {
+	var (
+		sum  summary
+		mu   sync.Mutex
+		next int
+		wg   sync.WaitGroup
+	)
+	results := make([]*result, len(args))
 	wg.Add(len(args))
 	s := semaphore.NewWeighted(int64(parallelism))
-	for _, arg := range args {
-		go func(arg string) {
+	for i, arg := range args {
+		go func(i int, arg string) {
 			defer wg.Add(-1)
+			res := &result{}
 			if err := s.Acquire(context.Background(), 1); err != nil {
-				log.Print(err)
-				return
+				res.err = err
+			} else {
+				res.changed, res.err = f(arg, &res.stdout, &res.stderr)
+				s.Release(1)
 			}
-			defer s.Release(1)
-			if err := f(arg); err != nil {
-				log.Print(err)
-				atomic.AddUintptr(&fails, 1)
+			mu.Lock()
+			defer mu.Unlock()
+			results[i] = res
+			for ; next < len(args) && results[next] != nil; next++ {
+				sum.add(args[next], results[next])
+				results[next] = nil
 			}
-		}(arg)
+		}(i, arg)
 	}
 	wg.Wait()
-	return int(fails)
+	return sum
+}
+
+func (sum *summary) add(filename string, res *result) {
+	if _, err := res.stdout.WriteTo(os.Stdout); err != nil && res.err == nil {
+		res.err = err
+	}
+	if output := strings.TrimSuffix(res.stderr.String(), "\n"); output != "" {
+		for _, line := range strings.Split(output, "\n") {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", filename, line)
+		}
+	}
+	switch {
+	case res.err != nil:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filename, res.err)
+		sum.failed++
+	case res.changed:
+		sum.changed++
+	default:
+		sum.unchanged++
+	}
+}
+
+var (
+	jobs      = flag.Int("j", runtime.NumCPU(), "run the utility on up to `n` files at once")
+	timeout   = flag.Duration("timeout", 0, "kill the utility if it runs longer than `duration` on a file")
+	nonempty  = flag.Bool("nonempty", false, "refuse to replace a nonempty file with empty output")
+	nul       = flag.Bool("0", false, "with -files-from, read NUL-separated file names")
+	filesFrom = flag.Bool("files-from", false, "read newline-separated file names from standard input")
+	fromDiff  = flag.Bool("from-diff", false, "read a unified diff from standard input and rewrite the files that it changes")
+	changed   = flag.Bool("changed-lines", false, "with -from-diff, keep only the changes that overlap the lines changed by the diff")
+	strip     = flag.Int("p", 0, "with -from-diff, strip `num` leading components from each path in the diff")
+	maxRatio  = flag.Float64("max-ratio", 0, "refuse output more than `ratio` times the size of the input")
+)
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+const (
+	pathPlaceholder = "{}"
+	tempPlaceholder = "{tmp}"
+)
+
+func substitute(args []string, placeholder, value string) []string {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		result[i] = strings.ReplaceAll(arg, placeholder, value)
+	}
+	return result
+}
+
+func usesPlaceholder(args []string, placeholder string) bool {
+	for _, arg := range args {
+		if strings.Contains(arg, placeholder) {
+			return true
+		}
+	}
+	return false
+}
+
+func run(args []string, filename string, r io.Reader, w, stderr io.Writer) error {
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	cr, cw := &countingReader{r: r}, &countingWriter{w: w}
+	args = substitute(args, pathPlaceholder, filename)
+	var err error
+	if usesPlaceholder(args, tempPlaceholder) {
+		err = runOnCopy(ctx, args, filename, cr, cw, stderr)
+	} else {
+		err = runFilter(ctx, args, cr, cw, stderr)
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %v", *timeout)
+		}
+		return err
+	}
+	if _, err := io.Copy(ioutil.Discard, cr); err != nil {
+		return err
+	}
+	if *nonempty && cr.n > 0 && cw.n == 0 {
+		return errors.New("refusing empty output")
+	}
+	if *maxRatio > 0 && float64(cw.n) > *maxRatio*float64(cr.n) {
+		return fmt.Errorf("refusing output of %d bytes for input of %d bytes", cw.n, cr.n)
+	}
+	return nil
+}
+
+func command(ctx context.Context, args []string, stderr io.Writer) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = stderr
+	cmd.WaitDelay = time.Second
+	return cmd
+}
+
+func runFilter(ctx context.Context, args []string, r io.Reader, w, stderr io.Writer) error {
+	cmd := command(ctx, args, stderr)
+	cmd.Stdin = r
+	cmd.Stdout = w
+	return cmd.Run()
+}
+
+func runOnCopy(ctx context.Context, args []string, filename string, r io.Reader, w, stderr io.Writer) error {
+	f, err := rewrite.CreateTemp(filename)
+	if err != nil {
+		return err
+	}
+	defer rewrite.RemoveTemp(f.Name())
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	cmd := command(ctx, substitute(args, tempPlaceholder, f.Name()), stderr)
+	cmd.Stdout = stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	return copyFile(w, f.Name())
+}
+
+// The utility may have replaced the copy rather than rewriting it.
+func copyFile(w io.Writer, name string) (err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func readFilenames(changedLines map[string][]diff.Interval) ([]string, error) {
+	if *fromDiff {
+		diffs, err := diff.ParseStrip(os.Stdin, *strip)
+		if err != nil {
+			return nil, err
+		}
+		var filenames []string
+		for _, d := range diffs {
+			if d.DstPath == os.DevNull || d.Binary {
+				continue
+			}
+			if _, ok := changedLines[d.DstPath]; !ok {
+				filenames = append(filenames, d.DstPath)
+			}
+			changedLines[d.DstPath] = append(changedLines[d.DstPath], d.DstChanges...)
+		}
+		return filenames, nil
+	}
+	if !*filesFrom {
+		return nil, nil
+	}
+	sep := "\n"
+	if *nul {
+		sep = string(rune(0))
+	}
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	var filenames []string
+	for _, filename := range strings.Split(string(data), sep) {
+		if filename != "" {
+			filenames = append(filenames, filename)
+		}
+	}
+	return filenames, nil
+}
+
+func runOnLines(args []string, filename string, lines []diff.Interval, r io.Reader, w, stderr io.Writer) error {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var dst bytes.Buffer
+	if err := run(args, filename, bytes.NewReader(src), &dst, stderr); err != nil {
+		return err
+	}
+	_, err = w.Write(diff.Restrict(src, dst.Bytes(), lines))
+	return err
+}
+
+func checkFlags() error {
+	switch {
+	case *jobs < 1:
+		return errors.New("-j must be positive")
+	case *filesFrom && *fromDiff:
+		return errors.New("-files-from conflicts with -from-diff")
+	case *nul && !*filesFrom:
+		return errors.New("-0 requires -files-from")
+	case *changed && !*fromDiff:
+		return errors.New("-changed-lines requires -from-diff")
+	}
+	return nil
 }
 
 func main() {
+	rewrite.Flags()
+	flag.Parse()
+	args := flag.Args()
 	var i int
-	for i = 1; i < len(os.Args); i++ {
-		if os.Args[i] == "--" {
+	for i = 0; i < len(args); i++ {
+		if args[i] == "--" {
 			break
 		}
 	}
-	if i < 2 || i >= len(os.Args) {
-		fmt.Fprintln(os.Stderr, "usage: rewrite-in-place utility_name [argument ...] -- [file ...]")
+	err := checkFlags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rewrite-in-place: %v\n", err)
+	}
+	if err != nil || i < 1 || i >= len(args) {
+		fmt.Fprintln(os.Stderr, "usage: rewrite-in-place [flags] utility_name [argument ...] -- [file ...]")
 		os.Exit(1)
 	}
-	fails := inParallel(runtime.NumCPU(), func(filename string) error {
-		return rewrite.File(filename, func(r io.Reader, w io.Writer) error {
-			cmd := exec.Command(os.Args[1], os.Args[2:i]...)
-			cmd.Stdin = r
-			cmd.Stdout = w
-			cmd.Stderr = os.Stderr
-			return cmd.Run()
+	changedLines := make(map[string][]diff.Interval)
+	filenames, err := readFilenames(changedLines)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sum := inParallel(*jobs, func(filename string, stdout, stderr io.Writer) (bool, error) {
+		return rewrite.File(filename, stdout, func(r io.Reader, w io.Writer) error {
+			if *changed {
+				return runOnLines(args[:i], filename, changedLines[filename], r, w, stderr)
+			}
+			return run(args[:i], filename, r, w, stderr)
 		})
-	}, os.Args[i+1:])
+	}, append(args[i+1:], filenames...))
+	fmt.Fprintf(os.Stderr, "%d succeeded (%d unchanged), %d failed\n", sum.changed+sum.unchanged, sum.unchanged, sum.failed)
+	fails := sum.failed
+	if fails == 0 && rewrite.WouldChange() {
+		fails = 1
+	}
 	const MAXFAILS = 125
 	if fails > MAXFAILS {
 		fails = MAXFAILS
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -46,7 +47,7 @@ func rewriteIfNeeded(shebang []byte, filename string) error {
 	if !needed {
 		return nil
 	}
-	return rewrite.File(filename, func(r io.Reader, w io.Writer) error {
+	_, err = rewrite.File(filename, os.Stdout, func(r io.Reader, w io.Writer) error {
 		b := bufio.NewReader(r)
 		data, err := b.Peek(len(shebangPrefix))
 		if err != nil && err != io.EOF {
@@ -72,28 +73,32 @@ func rewriteIfNeeded(shebang []byte, filename string) error {
 		_, err = io.Copy(w, b)
 		return err
 	})
+	return err
 }
 
 func main() {
+	rewrite.Flags()
+	flag.Parse()
+	args := flag.Args()
 	var i int
-	for i = 1; i < len(os.Args); i++ {
-		if os.Args[i] == "--" {
+	for i = 0; i < len(args); i++ {
+		if args[i] == "--" {
 			break
 		}
 	}
-	if i < 2 || i >= len(os.Args) {
-		fmt.Fprintln(os.Stderr, "usage: set-shebang utility_name [argument ...] -- [file ...]")
+	if i < 1 || i >= len(args) {
+		fmt.Fprintln(os.Stderr, "usage: set-shebang [flags] utility_name [argument ...] -- [file ...]")
 		os.Exit(1)
 	}
-	shebang := []byte(shebangPrefix + strings.Join(os.Args[1:i], " ") + "\n")
+	shebang := []byte(shebangPrefix + strings.Join(args[:i], " ") + "\n")
 	fail := false
-	for _, filename := range os.Args[i+1:] {
+	for _, filename := range args[i+1:] {
 		if err := rewriteIfNeeded(shebang, filename); err != nil {
 			log.Print(err)
 			fail = true
 		}
 	}
-	if fail {
+	if fail || rewrite.WouldChange() {
 		os.Exit(1)
 	}
 }
@@ -4,35 +4,14 @@ import (
 	"bufio"
 	"io"
 	"io/ioutil"
-	"log"
-	"os"
 	"regexp"
-	"strings"
 
 	"github.com/eisenstatdavid/tools/internal/diff"
-	"github.com/eisenstatdavid/tools/internal/rewrite"
+	"github.com/eisenstatdavid/tools/internal/driver"
 )
 
 func main() {
-	diffs, err := diff.Parse(os.Stdin)
-	if err != nil {
-		log.Fatal(err)
-	}
-	fail := false
-	for _, d := range diffs {
-		if d.DstPath == os.DevNull || strings.HasSuffix(d.DstPath, ".go") {
-			continue
-		}
-		if err := rewrite.File(d.DstPath, func(r io.Reader, w io.Writer) error {
-			return rewriteChangedLines(d.DstChanges, r, w)
-		}); err != nil {
-			log.Print(err)
-			fail = true
-		}
-	}
-	if fail {
-		os.Exit(1)
-	}
+	driver.Main(driver.RewriterFunc(rewriteChangedLines), "*.go")
 }
 
 const stringExpr = `"(?:[^\n"\\]|\\[^\n])*"`
@@ -42,7 +21,7 @@ var (
 	stringsRegexp = regexp.MustCompile(stringExpr + `(?:\s*` + stringExpr + `)*`)
 )
 
-func rewriteChangedLines(changes []diff.Interval, r io.Reader, w io.Writer) error {
+func rewriteChangedLines(_ string, changes []diff.Interval, r io.Reader, w io.Writer) error {
 	content, err := ioutil.ReadAll(r)
 	if err != nil {
 		return err
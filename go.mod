@@ -5,10 +5,8 @@ go 1.24.2
 require (
 	golang.org/x/crypto v0.46.0
 	golang.org/x/sync v0.19.0
+	golang.org/x/sys v0.39.0
 	golang.org/x/text v0.32.0
 )
 
-require (
-	golang.org/x/sys v0.39.0 // indirect
-	golang.org/x/term v0.38.0 // indirect
-)
+require golang.org/x/term v0.38.0 // indirect
@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/eisenstatdavid/tools/internal/scanner"
 )
@@ -19,12 +21,28 @@ func (i Interval) empty() bool {
 }
 
 type Diff struct {
-	DstPath    string
-	DstChanges []Interval
+	SrcPath, DstPath string
+	SrcMode, DstMode uint32
+	Rename, Copy     bool
+	Similarity       int
+	Binary           bool
+	SrcChanges       []Interval
+	DstChanges       []Interval
+	Hunks            []Hunk
+}
+
+type Hunk struct {
+	Src, Dst Interval
+	Section  string
+	Lines    []string
 }
 
 func Parse(r io.Reader) ([]Diff, error) {
-	p := parser{}
+	return ParseStrip(r, 0)
+}
+
+func ParseStrip(r io.Reader, strip int) ([]Diff, error) {
+	p := parser{strip: strip}
 	s := scanner.Make(r)
 	for s.Scan() {
 		if err := p.feedLine(s.Text()); err != nil {
@@ -40,6 +58,10 @@ func Parse(r io.Reader) ([]Diff, error) {
 type parser struct {
 	diffs                               []Diff
 	readyForDstPath, readyForHunkHeader bool
+	inGitDiff, inGitHeader              bool
+	inBinaryPatch                       bool
+	gitNames, gitSrc, gitDst            string
+	strip                               int
 	hunkHeader
 }
 
@@ -50,6 +72,24 @@ func (p *parser) feedLine(s string) error {
 		}
 		return nil
 	}
+	if p.inBinaryPatch {
+		if binaryPatchRegexp.MatchString(s) {
+			return nil
+		}
+		p.inBinaryPatch = false
+	}
+	if p.inGitHeader {
+		ok, err := p.feedGitHeader(s)
+		if err != nil {
+			return fmt.Errorf("in git header: %v", err)
+		}
+		if ok {
+			return nil
+		}
+		if err := p.closeGitHeader(); err != nil {
+			return fmt.Errorf("in git header: %v", err)
+		}
+	}
 	return p.feedNotInHunk(s)
 }
 
@@ -63,12 +103,14 @@ func (p *parser) feedInHunk(s string) error {
 		if p.src.empty() {
 			return errors.New("unexpected src text")
 		}
+		p.changeSrc(1)
 		p.changeDst(0)
 		p.src.Start++
 	case '+':
 		if p.dst.empty() {
 			return errors.New("unexpected dst text")
 		}
+		p.changeSrc(0)
 		p.changeDst(1)
 		p.dst.Start++
 	case ' ':
@@ -81,14 +123,26 @@ func (p *parser) feedInHunk(s string) error {
 	default:
 		return errors.New("unexpected comment")
 	}
+	p.appendHunkLine(s)
 	return nil
 }
 
+func (p *parser) changeSrc(count uint64) {
+	d := &p.diffs[len(p.diffs)-1]
+	d.SrcChanges = appendInterval(d.SrcChanges, Interval{p.src.Start, p.src.Start + count})
+}
+
 func (p *parser) changeDst(count uint64) {
 	d := &p.diffs[len(p.diffs)-1]
 	d.DstChanges = appendInterval(d.DstChanges, Interval{p.dst.Start, p.dst.Start + count})
 }
 
+func (p *parser) appendHunkLine(s string) {
+	d := &p.diffs[len(p.diffs)-1]
+	h := &d.Hunks[len(d.Hunks)-1]
+	h.Lines = append(h.Lines, s)
+}
+
 func appendInterval(intervals []Interval, i Interval) []Interval {
 	if n := len(intervals); n > 0 && intervals[n-1].Stop == i.Start {
 		intervals[n-1].Stop = i.Stop
@@ -100,17 +154,22 @@ func appendInterval(intervals []Interval, i Interval) []Interval {
 func (p *parser) feedNotInHunk(s string) error {
 	switch s[0] {
 	case '-':
-		if _, err := parsePath(s); err != nil {
+		path, err := p.parsePath(s)
+		if err != nil {
 			return err
 		}
 		if p.readyForDstPath {
 			return errors.New("unexpected src path")
 		}
+		if !p.inGitDiff {
+			p.diffs = append(p.diffs, Diff{})
+		}
+		p.inGitDiff = false
 		p.readyForHunkHeader = false
-		p.diffs = append(p.diffs, Diff{})
+		p.diffs[len(p.diffs)-1].SrcPath = path
 		p.readyForDstPath = true
 	case '+':
-		path, err := parsePath(s)
+		path, err := p.parsePath(s)
 		if err != nil {
 			return err
 		}
@@ -139,33 +198,201 @@ func (p *parser) feedNotInHunk(s string) error {
 			return errors.New("unequal skip lengths")
 		}
 		p.hunkHeader = h
+		d := &p.diffs[len(p.diffs)-1]
+		d.Hunks = append(d.Hunks, Hunk{Src: h.src, Dst: h.dst, Section: h.section})
 	case ' ':
 		return errors.New("unexpected context")
 	case '\\':
+		if p.readyForHunkHeader && len(p.diffs[len(p.diffs)-1].Hunks) > 0 {
+			p.appendHunkLine(s)
+		}
 	default:
 		if p.readyForDstPath {
 			return errors.New("unexpected comment")
 		}
 		p.readyForHunkHeader = false
+		p.inGitDiff = false
+		if m := gitDiffRegexp.FindStringSubmatch(s); m != nil {
+			p.diffs = append(p.diffs, Diff{})
+			p.inGitDiff, p.inGitHeader = true, true
+			p.gitNames, p.gitSrc, p.gitDst = m[1], "", ""
+		}
 	}
 	return nil
 }
 
-var pathRegexp = regexp.MustCompile(`^(?:---|\+\+\+) ([^\t\n"\\]+)[\t\n]`)
+var (
+	gitDiffRegexp     = regexp.MustCompile(`^diff --git ([^\n]*)\n?$`)
+	gitHeaderRegexp   = regexp.MustCompile(`^(old mode|new mode|deleted file mode|new file mode|index|copy from|copy to|rename from|rename to|rename old|rename new|similarity index|dissimilarity index) ([^\n]*)\n?$`)
+	gitBinaryRegexp   = regexp.MustCompile(`^(?:Binary files [^\n]* differ|GIT binary patch)\n?$`)
+	indexRegexp       = regexp.MustCompile(`^[0-9a-f]+\.\.[0-9a-f]+(?: ([0-7]+))?$`)
+	similarityRegexp  = regexp.MustCompile(`^(\d+)%$`)
+	binaryPatchRegexp = regexp.MustCompile(`^(?:(?:literal|delta) \d+|[A-Za-z][!-~]*)?\n?$`)
+)
+
+func (p *parser) feedGitHeader(s string) (bool, error) {
+	d := &p.diffs[len(p.diffs)-1]
+	if m := gitBinaryRegexp.FindStringSubmatch(s); m != nil {
+		d.Binary = true
+		p.inBinaryPatch = strings.HasPrefix(s, "GIT")
+		return true, nil
+	}
+	m := gitHeaderRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return false, nil
+	}
+	var err error
+	switch value := m[2]; m[1] {
+	case "old mode":
+		d.SrcMode, err = parseMode(value)
+	case "new mode":
+		d.DstMode, err = parseMode(value)
+	case "deleted file mode":
+		d.SrcMode, err = parseMode(value)
+		d.DstPath = os.DevNull
+	case "new file mode":
+		d.DstMode, err = parseMode(value)
+		d.SrcPath = os.DevNull
+	case "index":
+		m := indexRegexp.FindStringSubmatch(value)
+		if m == nil {
+			return false, errors.New("invalid index line")
+		}
+		if m[1] != "" {
+			d.SrcMode, err = parseMode(m[1])
+			d.DstMode = d.SrcMode
+		}
+	case "copy from":
+		d.Copy = true
+		p.gitSrc, err = parseName(value)
+	case "copy to":
+		d.Copy = true
+		p.gitDst, err = parseName(value)
+	case "rename from", "rename old":
+		d.Rename = true
+		p.gitSrc, err = parseName(value)
+	case "rename to", "rename new":
+		d.Rename = true
+		p.gitDst, err = parseName(value)
+	case "similarity index":
+		d.Similarity, err = parseSimilarity(value)
+	case "dissimilarity index":
+		_, err = parseSimilarity(value)
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", m[1], err)
+	}
+	return true, nil
+}
+
+func parseMode(s string) (uint32, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	return uint32(mode), err
+}
 
-func parsePath(s string) (string, error) {
+func parseSimilarity(s string) (int, error) {
+	m := similarityRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, errors.New("invalid percentage")
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n > 100 {
+		return 0, errors.New("percentage out of range")
+	}
+	return n, nil
+}
+
+func (p *parser) closeGitHeader() error {
+	p.inGitHeader = false
+	d := &p.diffs[len(p.diffs)-1]
+	src, dst := splitGitNames(p.gitNames, p.gitSrc, p.gitDst)
+	strip := p.strip
+	if src == "" {
+		// The rename and copy lines omit the prefix.
+		src, dst = p.gitSrc, p.gitDst
+		if strip > 0 {
+			strip--
+		}
+	}
+	var err error
+	if d.SrcPath == "" && src != "" {
+		if d.SrcPath, err = stripPath(src, strip); err != nil {
+			return err
+		}
+	}
+	if d.DstPath == "" && dst != "" {
+		if d.DstPath, err = stripPath(dst, strip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Like git, resolve the ambiguity of names containing spaces by requiring them
+// to agree after the prefix is removed, or with the rename or copy lines.
+func splitGitNames(s, src, dst string) (string, string) {
+	if strings.HasPrefix(s, `"`) {
+		a, rest, err := unquotePrefix(s)
+		if err != nil || !strings.HasPrefix(rest, " ") {
+			return "", ""
+		}
+		b, err := parseName(rest[1:])
+		if err != nil {
+			return "", ""
+		}
+		return a, b
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != ' ' {
+			continue
+		}
+		a, b := s[:i], s[i+1:]
+		if strings.HasPrefix(b, `"`) {
+			if b, err := parseName(b); err == nil {
+				return a, b
+			}
+		} else if src != "" && dst != "" {
+			if hasName(a, src) && hasName(b, dst) {
+				return a, b
+			}
+		} else if stripPrefix(a) == stripPrefix(b) {
+			return a, b
+		}
+	}
+	return "", ""
+}
+
+func hasName(path, name string) bool {
+	return path == name || stripPrefix(path) == name
+}
+
+func stripPrefix(path string) string {
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+var pathRegexp = regexp.MustCompile(`^(?:---|\+\+\+) ("(?:[^\n"\\]|\\[^\n])*"|[^\t\n"][^\t\n]*)[\t\n]`)
+
+func (p *parser) parsePath(s string) (string, error) {
 	m := pathRegexp.FindStringSubmatch(s)
 	if m == nil {
 		return "", errors.New("invalid diff header")
 	}
-	return m[1], nil
+	path, err := parseName(m[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid diff header: %v", err)
+	}
+	return stripPath(path, p.strip)
 }
 
 type hunkHeader struct {
 	src, dst Interval
+	section  string
 }
 
-var hunkHeaderRegexp = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+var hunkHeaderRegexp = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@(?: ([^\n]*))?`)
 
 func parseHunkHeader(s string) (hunkHeader, error) {
 	m := hunkHeaderRegexp.FindStringSubmatch(s)
@@ -183,7 +410,7 @@ func parseHunkHeader(s string) (hunkHeader, error) {
 	if src.empty() && dst.empty() {
 		return hunkHeader{}, errors.New("empty hunk")
 	}
-	return hunkHeader{src, dst}, nil
+	return hunkHeader{src, dst, m[5]}, nil
 }
 
 func parseInterval(s, c string) (Interval, error) {
@@ -216,6 +443,11 @@ func parseCount(c string) (uint64, error) {
 }
 
 func (p *parser) close() ([]Diff, error) {
+	if p.inGitHeader {
+		if err := p.closeGitHeader(); err != nil {
+			return nil, err
+		}
+	}
 	if p.inHunk() || p.readyForDstPath {
 		return nil, errors.New("unexpected end of input")
 	}
@@ -0,0 +1,121 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var unescapes = map[byte]byte{
+	'a':  '\a',
+	'b':  '\b',
+	'f':  '\f',
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+	'v':  '\v',
+	'"':  '"',
+	'\\': '\\',
+}
+
+func quoteName(name string) string {
+	quote := false
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c < ' ' || c == '"' || c == '\\' || c >= 0x7f {
+			quote = true
+			break
+		}
+	}
+	if !quote {
+		return name
+	}
+	var b strings.Builder
+	_ = b.WriteByte('"')
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if e, ok := escapes[c]; ok {
+			_ = b.WriteByte('\\')
+			_ = b.WriteByte(e)
+		} else if c < ' ' || c >= 0x7f {
+			_, _ = fmt.Fprintf(&b, "\\%o%o%o", c>>6, c>>3&7, c&7)
+		} else {
+			_ = b.WriteByte(c)
+		}
+	}
+	_ = b.WriteByte('"')
+	return b.String()
+}
+
+var escapes = func() map[byte]byte {
+	m := make(map[byte]byte, len(unescapes))
+	for e, c := range unescapes {
+		m[c] = e
+	}
+	return m
+}()
+
+func unquotePrefix(s string) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", "", errors.New("missing opening quote")
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", errors.New("unterminated escape")
+			}
+			if u, ok := unescapes[s[i+1]]; ok {
+				_ = b.WriteByte(u)
+				i += 2
+				continue
+			}
+			if i+3 >= len(s) || !isOctal(s[i+1]) || s[i+1] > '3' || !isOctal(s[i+2]) || !isOctal(s[i+3]) {
+				return "", "", errors.New("invalid escape")
+			}
+			_ = b.WriteByte((s[i+1]-'0')<<6 | (s[i+2]-'0')<<3 | (s[i+3] - '0'))
+			i += 4
+		case '\n':
+			return "", "", errors.New("unterminated quote")
+		default:
+			_ = b.WriteByte(c)
+			i++
+		}
+	}
+	return "", "", errors.New("unterminated quote")
+}
+
+func isOctal(c byte) bool {
+	return '0' <= c && c <= '7'
+}
+
+func parseName(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	name, rest, err := unquotePrefix(s)
+	if err != nil {
+		return "", err
+	}
+	if rest != "" {
+		return "", errors.New("text after closing quote")
+	}
+	return name, nil
+}
+
+func stripPath(path string, n int) (string, error) {
+	if path == os.DevNull {
+		return path, nil
+	}
+	for ; n > 0; n-- {
+		i := strings.IndexByte(path, '/')
+		if i < 0 {
+			return "", errors.New("too few path components to strip")
+		}
+		path = strings.TrimLeft(path[i+1:], "/")
+	}
+	return path, nil
+}
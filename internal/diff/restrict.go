@@ -0,0 +1,62 @@
+package diff
+
+import "strings"
+
+func Restrict(src, dst []byte, changes []Interval) []byte {
+	a, b := splitLines(string(src)), splitLines(string(dst))
+	ops := editScript(a, b)
+	aPos, bPos := positions(ops)
+	var result strings.Builder
+	for i := 0; i < len(ops); {
+		if ops[i] == ' ' {
+			_, _ = result.WriteString(a[aPos[i]])
+			i++
+			continue
+		}
+		j := i
+		for j < len(ops) && ops[j] != ' ' {
+			j++
+		}
+		for _, line := range restrictBlock(a, b, aPos[i], aPos[j], bPos[i], bPos[j], changes) {
+			_, _ = result.WriteString(line)
+		}
+		i = j
+	}
+	return []byte(result.String())
+}
+
+// When a block replaces lines one for one, as reindenting does, decide for each
+// line separately.
+func restrictBlock(a, b []string, aStart, aStop, bStart, bStop int, changes []Interval) []string {
+	if aStop-aStart != bStop-bStart {
+		if overlapsAny(aStart, aStop, changes) {
+			return b[bStart:bStop]
+		}
+		return a[aStart:aStop]
+	}
+	var lines []string
+	for i := 0; i < aStop-aStart; i++ {
+		if overlapsAny(aStart+i, aStart+i+1, changes) {
+			lines = append(lines, b[bStart+i])
+		} else {
+			lines = append(lines, a[aStart+i])
+		}
+	}
+	return lines
+}
+
+// Lines are numbered from 0 in [start, stop) and from 1 in changes. Empty
+// ranges overlap the lines on either side.
+func overlapsAny(start, stop int, changes []Interval) bool {
+	for _, c := range changes {
+		cStart, cStop := int(c.Start)-1, int(c.Stop)-1
+		if start == stop || cStart == cStop {
+			if cStart <= stop && start <= cStop {
+				return true
+			}
+		} else if cStart < stop && start < cStop {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,244 @@
+package diff
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func Write(w io.Writer, srcPath, dstPath string, src, dst []byte, context int) error {
+	a, b := splitLines(string(src)), splitLines(string(dst))
+	ops := editScript(a, b)
+	hunks := groupHunks(ops, context)
+	if len(hunks) == 0 {
+		return nil
+	}
+	bw := bufio.NewWriter(w)
+	srcName, dstName := prefixName("a/", srcPath), prefixName("b/", dstPath)
+	gitSrc, gitDst := srcName, dstName
+	if srcPath == os.DevNull {
+		gitSrc = prefixName("a/", dstPath)
+	}
+	if dstPath == os.DevNull {
+		gitDst = prefixName("b/", srcPath)
+	}
+	if _, err := fmt.Fprintf(bw, "diff --git %s %s\n", gitSrc, gitDst); err != nil {
+		return err
+	}
+	srcHash, dstHash := blobHash(src), blobHash(dst)
+	switch {
+	case srcPath == os.DevNull:
+		srcHash = nullHash
+		if _, err := fmt.Fprintf(bw, "new file mode %o\n", regularMode); err != nil {
+			return err
+		}
+	case dstPath == os.DevNull:
+		dstHash = nullHash
+		if _, err := fmt.Fprintf(bw, "deleted file mode %o\n", regularMode); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(bw, "index %s..%s\n--- %s\n+++ %s\n", srcHash, dstHash, srcName, dstName); err != nil {
+		return err
+	}
+	aPos, bPos := positions(ops)
+	for _, h := range hunks {
+		if _, err := fmt.Fprintf(bw, "@@ -%s +%s @@\n",
+			formatRange(aPos[h.start], aPos[h.stop]),
+			formatRange(bPos[h.start], bPos[h.stop])); err != nil {
+			return err
+		}
+		for i := h.start; i < h.stop; i++ {
+			var line string
+			if ops[i] == '-' {
+				line = a[aPos[i]]
+			} else {
+				line = b[bPos[i]]
+			}
+			if err := writeLine(bw, ops[i], line); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+const regularMode = 0o100644
+
+var nullHash = strings.Repeat("0", 7)
+
+// Abbreviated as git does, to seven hex digits.
+func blobHash(data []byte) string {
+	h := sha1.New()
+	_, _ = fmt.Fprintf(h, "blob %d", len(data))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(data)
+	return fmt.Sprintf("%x", h.Sum(nil))[:7]
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func prefixName(prefix, path string) string {
+	if path == os.DevNull {
+		return path
+	}
+	return quoteName(prefix + path)
+}
+
+func formatRange(start, stop int) string {
+	switch count := stop - start; count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
+
+func writeLine(bw *bufio.Writer, op byte, line string) error {
+	if err := bw.WriteByte(op); err != nil {
+		return err
+	}
+	if _, err := bw.WriteString(line); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(line, "\n") {
+		_, err := bw.WriteString("\n\\ No newline at end of file\n")
+		return err
+	}
+	return nil
+}
+
+// Each op is ' ', '-' or '+' and consumes a line of a, b, or both.
+func editScript(a, b []string) []byte {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops := make([]byte, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, ' ')
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for i := 0; i < suffix; i++ {
+		ops = append(ops, ' ')
+	}
+	return ops
+}
+
+func myers(a, b []string) []byte {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+	for d := 0; ; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+}
+
+func backtrack(trace [][]int, x, y int) []byte {
+	var ops []byte
+	for d := len(trace); d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || k != d && at(k-1) < at(k+1) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, ' ')
+			x--
+			y--
+		}
+		if prevK == k+1 {
+			ops = append(ops, '+')
+		} else {
+			ops = append(ops, '-')
+		}
+		x, y = prevX, prevY
+	}
+	for ; x > 0; x-- {
+		ops = append(ops, ' ')
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+type opRange struct {
+	start, stop int
+}
+
+func groupHunks(ops []byte, context int) []opRange {
+	if context < 0 {
+		context = 0
+	}
+	var hunks []opRange
+	for i, op := range ops {
+		if op == ' ' {
+			continue
+		}
+		start, stop := i-context, i+1+context
+		if start < 0 {
+			start = 0
+		}
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+		if n := len(hunks); n > 0 && hunks[n-1].stop >= start {
+			hunks[n-1].stop = stop
+			continue
+		}
+		hunks = append(hunks, opRange{start, stop})
+	}
+	return hunks
+}
+
+func positions(ops []byte) ([]int, []int) {
+	aPos, bPos := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op != '+' {
+			aPos[i+1]++
+		}
+		if op != '-' {
+			bPos[i+1]++
+		}
+	}
+	return aPos, bPos
+}
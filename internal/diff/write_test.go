@@ -0,0 +1,148 @@
+package diff
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func randomText(r *rand.Rand) string {
+	var b strings.Builder
+	n := r.Intn(8)
+	for i := 0; i < n; i++ {
+		_ = b.WriteByte("abc"[r.Intn(3)])
+		if i < n-1 || r.Intn(4) > 0 {
+			_ = b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+func apply(src string, d Diff) string {
+	a := splitLines(src)
+	var b []string
+	i := 0
+	for _, h := range d.Hunks {
+		start := int(h.Src.Start) - 1
+		b = append(b, a[i:start]...)
+		i = start
+		var op byte
+		for _, line := range h.Lines {
+			switch line[0] {
+			case ' ':
+				b = append(b, a[i])
+				i++
+			case '-':
+				i++
+			case '+':
+				b = append(b, line[1:])
+			case '\\':
+				if op == '+' {
+					b[len(b)-1] = strings.TrimSuffix(b[len(b)-1], "\n")
+				}
+			}
+			op = line[0]
+		}
+	}
+	return strings.Join(append(b, a[i:]...), "")
+}
+
+func TestWriteParseRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 3000; n++ {
+		srcPath, dstPath := "dir/old name", "dir/new\tname"
+		src, dst := randomText(r), randomText(r)
+		switch r.Intn(4) {
+		case 0:
+			srcPath, src = os.DevNull, ""
+		case 1:
+			dstPath, dst = os.DevNull, ""
+		}
+		var w bytes.Buffer
+		if err := Write(&w, srcPath, dstPath, []byte(src), []byte(dst), r.Intn(4)); err != nil {
+			t.Fatal(err)
+		}
+		diffs, err := ParseStrip(bytes.NewReader(w.Bytes()), 1)
+		if err != nil {
+			t.Fatalf("%q: %v", w.String(), err)
+		}
+		if src == dst {
+			if len(diffs) != 0 {
+				t.Errorf("%q: got %d diffs for equal inputs", w.String(), len(diffs))
+			}
+			continue
+		}
+		if len(diffs) != 1 {
+			t.Fatalf("%q: got %d diffs, want 1", w.String(), len(diffs))
+		}
+		d := diffs[0]
+		if d.SrcPath != srcPath || d.DstPath != dstPath {
+			t.Errorf("%q: got paths %q and %q, want %q and %q", w.String(), d.SrcPath, d.DstPath, srcPath, dstPath)
+		}
+		if got := apply(src, d); got != dst {
+			t.Errorf("%q: applying to %q gives %q, want %q", w.String(), src, got, dst)
+		}
+	}
+}
+
+func TestParseGitHeaders(t *testing.T) {
+	for _, test := range []struct {
+		name, input string
+		want        []Diff
+	}{
+		{
+			"rename",
+			"diff --git a/old name b/new name\nsimilarity index 100%\nrename from old name\nrename to new name\n",
+			[]Diff{{SrcPath: "old name", DstPath: "new name", Rename: true, Similarity: 100}},
+		},
+		{
+			"copy",
+			"diff --git a/a b/b c\nsimilarity index 90%\ncopy from a\ncopy to b c\n--- a/a\n+++ b/b c\n@@ -1 +1 @@\n-x\n+y\n",
+			[]Diff{{SrcPath: "a", DstPath: "b c", Copy: true, Similarity: 90, SrcChanges: []Interval{{1, 2}}, DstChanges: []Interval{{1, 2}}}},
+		},
+		{
+			"mode",
+			"diff --git a/a b/c b/a b/c\nold mode 100644\nnew mode 100755\n",
+			[]Diff{{SrcPath: "a b/c", DstPath: "a b/c", SrcMode: 0o100644, DstMode: 0o100755}},
+		},
+		{
+			"quoted",
+			"diff --git \"a/tab\\tname\" b/plain\nsimilarity index 100%\nrename from \"tab\\tname\"\nrename to plain\n",
+			[]Diff{{SrcPath: "tab\tname", DstPath: "plain", Rename: true, Similarity: 100}},
+		},
+		{
+			"deleted",
+			"diff --git a/gone file b/gone file\ndeleted file mode 100644\nindex e69de29..1234567\n",
+			[]Diff{{SrcPath: "gone file", DstPath: os.DevNull, SrcMode: 0o100644}},
+		},
+		{
+			"binary files differ",
+			"diff --git a/img.png b/img.png\nindex 1234567..89abcde 100644\nBinary files a/img.png and b/img.png differ\n",
+			[]Diff{{SrcPath: "img.png", DstPath: "img.png", SrcMode: 0o100644, DstMode: 0o100644, Binary: true}},
+		},
+		{
+			"binary patch",
+			"diff --git a/bin b/bin\nnew file mode 100644\nindex 1234567..e69de29\nGIT binary patch\nliteral 3\nKcmZ?wWMTjS1IC2\n\nliteral 0\nHcmV?d1\n\n" +
+				"diff --git a/t b/t\n--- a/t\n+++ b/t\n@@ -1 +1 @@\n-x\n+y\n",
+			[]Diff{
+				{SrcPath: os.DevNull, DstPath: "bin", DstMode: 0o100644, Binary: true},
+				{SrcPath: "t", DstPath: "t", SrcChanges: []Interval{{1, 2}}, DstChanges: []Interval{{1, 2}}},
+			},
+		},
+	} {
+		got, err := ParseStrip(strings.NewReader(test.input), 1)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for i := range got {
+			got[i].Hunks = nil
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/eisenstatdavid/tools/internal/diff"
+	"github.com/eisenstatdavid/tools/internal/glob"
+	"github.com/eisenstatdavid/tools/internal/ignore"
+	"github.com/eisenstatdavid/tools/internal/rewrite"
+)
+
+type Rewriter interface {
+	RewriteChangedLines(path string, changes []diff.Interval, r io.Reader, w io.Writer) error
+}
+
+type RewriterFunc func(path string, changes []diff.Interval, r io.Reader, w io.Writer) error
+
+func (f RewriterFunc) RewriteChangedLines(path string, changes []diff.Interval, r io.Reader, w io.Writer) error {
+	return f(path, changes, r, w)
+}
+
+type patterns struct {
+	globs   []string
+	regexps []*regexp.Regexp
+	dirOnly []bool
+}
+
+func (p *patterns) String() string {
+	return strings.Join(p.globs, ",")
+}
+
+// As in .gitignore, a pattern with a trailing slash matches only directories.
+func (p *patterns) Set(pattern string) error {
+	trimmed := strings.TrimRight(pattern, "/")
+	if trimmed == "" {
+		return errors.New("empty pattern")
+	}
+	re, err := glob.Compile(trimmed, false)
+	if err != nil {
+		return err
+	}
+	p.globs = append(p.globs, pattern)
+	p.regexps = append(p.regexps, re)
+	p.dirOnly = append(p.dirOnly, trimmed != pattern)
+	return nil
+}
+
+var (
+	strip            = flag.Int("p", 0, "strip `num` leading components from each path in the diff")
+	jobs             = flag.Int("j", runtime.NumCPU(), "rewrite up to `n` files at once")
+	ignoreFile       = flag.String("ignore-file", "", "skip the paths that match the patterns in `file`, which uses the syntax of .gitignore")
+	include, exclude patterns
+	ignored          *ignore.Matcher
+)
+
+func init() {
+	flag.Var(&include, "include", "rewrite only the paths that match `glob` (repeatable)")
+	flag.Var(&exclude, "exclude", "skip the paths that match `glob` (repeatable)")
+}
+
+// Main rewrites the files changed by the diff on standard input. Paths that
+// match one of the given patterns are skipped as if they were excluded, as are
+// generated files.
+func Main(rw Rewriter, skip ...string) {
+	rewrite.Flags()
+	flag.Parse()
+	if *jobs < 1 {
+		log.Fatal("-j must be positive")
+	}
+	for _, pattern := range skip {
+		if err := exclude.Set(pattern); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *ignoreFile != "" {
+		var err error
+		if ignored, err = ignore.Load(*ignoreFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	diffs, err := diff.ParseStrip(os.Stdin, *strip)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var (
+		paths   []string
+		changes = make(map[string][]diff.Interval)
+	)
+	for _, d := range diffs {
+		if d.DstPath == os.DevNull || d.Binary || !selected(d.DstPath) {
+			continue
+		}
+		if _, ok := changes[d.DstPath]; !ok {
+			paths = append(paths, d.DstPath)
+		}
+		changes[d.DstPath] = append(changes[d.DstPath], d.DstChanges...)
+	}
+	var (
+		fail atomic.Bool
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		next int
+	)
+	// Print the output for each path in order, as soon as the paths before it are
+	// done.
+	outputs := make([]*bytes.Buffer, len(paths))
+	s := semaphore.NewWeighted(int64(*jobs))
+	for i, path := range paths {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			out := &bytes.Buffer{}
+			defer func() {
+				mu.Lock()
+				defer mu.Unlock()
+				outputs[i] = out
+				for ; next < len(paths) && outputs[next] != nil; next++ {
+					if _, err := outputs[next].WriteTo(os.Stdout); err != nil {
+						log.Print(err)
+						fail.Store(true)
+					}
+					outputs[next] = nil
+				}
+			}()
+			if err := s.Acquire(context.Background(), 1); err != nil {
+				log.Print(err)
+				fail.Store(true)
+				return
+			}
+			defer s.Release(1)
+			if ok, err := isGenerated(path); err != nil {
+				log.Printf("%s: %v", path, err)
+				fail.Store(true)
+				return
+			} else if ok {
+				return
+			}
+			merged := merge(changes[path])
+			if _, err := rewrite.File(path, out, func(r io.Reader, w io.Writer) error {
+				return rw.RewriteChangedLines(path, merged, r, w)
+			}); err != nil {
+				log.Printf("%s: %v", path, err)
+				fail.Store(true)
+			}
+		}(i, path)
+	}
+	wg.Wait()
+	if fail.Load() || rewrite.WouldChange() {
+		os.Exit(1)
+	}
+}
+
+// Rewriters expect the changes in order, so sort them and merge the ones that
+// overlap.
+func merge(changes []diff.Interval) []diff.Interval {
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Start != changes[j].Start {
+			return changes[i].Start < changes[j].Start
+		}
+		return changes[i].Stop < changes[j].Stop
+	})
+	var merged []diff.Interval
+	for _, c := range changes {
+		if n := len(merged); n > 0 && c.Start < merged[n-1].Stop {
+			if c.Stop > merged[n-1].Stop {
+				merged[n-1].Stop = c.Stop
+			}
+			continue
+		}
+		merged = append(merged, c)
+	}
+	return merged
+}
+
+func selected(path string) bool {
+	if len(include.regexps) > 0 && !matchesAny(include, path) {
+		return false
+	}
+	if ignored != nil && ignored.Match(path) {
+		return false
+	}
+	return !matchesAny(exclude, path)
+}
+
+var (
+	generatedRegexp = regexp.MustCompile(`^[\t ]*(?://|#|--|/\*)[\t ]*Code generated .* DO NOT EDIT\.`)
+	gutterRegexp    = regexp.MustCompile(`^[\t ]*\*?[\t ]*Code generated .* DO NOT EDIT\.`)
+	headerRegexp    = regexp.MustCompile(`^[\t ]*(?://|#|--|;|%|/\*|\r?\n?$)`)
+)
+
+// Generated files are marked as in https://go.dev/s/generatedcode, with the
+// comment syntax of the language, before the first line that is neither blank
+// nor a comment.
+func isGenerated(path string) (ok bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	br := bufio.NewReader(f)
+	inBlock := false
+	for {
+		line, err := br.ReadString('\n')
+		switch {
+		case inBlock && gutterRegexp.MatchString(line):
+			return true, nil
+		case inBlock:
+			inBlock = !strings.Contains(line, "*/")
+		case generatedRegexp.MatchString(line):
+			return true, nil
+		case !headerRegexp.MatchString(line):
+			return false, nil
+		default:
+			i := strings.Index(line, "/*")
+			inBlock = i >= 0 && !strings.Contains(line[i+2:], "*/")
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// A pattern without a slash matches the base name. A pattern that matches a
+// directory matches everything under it.
+func matchesAny(p patterns, path string) bool {
+	for i, re := range p.regexps {
+		for q, isDir := filepath.Clean(path), false; q != "." && q != string(filepath.Separator); q, isDir = filepath.Dir(q), true {
+			if (isDir || !p.dirOnly[i]) && re.MatchString(filepath.ToSlash(q)) {
+				return true
+			}
+		}
+	}
+	return false
+}
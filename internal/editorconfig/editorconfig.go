@@ -0,0 +1,133 @@
+package editorconfig
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/eisenstatdavid/tools/internal/glob"
+)
+
+type section struct {
+	pattern    *regexp.Regexp
+	properties map[string]string
+}
+
+type file struct {
+	root     bool
+	sections []section
+}
+
+var cache struct {
+	sync.Mutex
+	files map[string]*file
+}
+
+// Lookup returns the properties that apply to path, with closer files taking
+// precedence over files higher up in the tree.
+func Lookup(path string) (map[string]string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		f, err := load(dir)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil && f.root || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	properties := make(map[string]string)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		f, _ := load(dirs[i])
+		if f == nil {
+			continue
+		}
+		rel, err := filepath.Rel(dirs[i], path)
+		if err != nil {
+			return nil, err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, s := range f.sections {
+			if s.pattern.MatchString(rel) {
+				for k, v := range s.properties {
+					properties[k] = v
+				}
+			}
+		}
+	}
+	return properties, nil
+}
+
+func load(dir string) (*file, error) {
+	cache.Lock()
+	defer cache.Unlock()
+	if f, ok := cache.files[dir]; ok {
+		return f, nil
+	}
+	f, err := parse(filepath.Join(dir, ".editorconfig"))
+	if err != nil {
+		return nil, err
+	}
+	if cache.files == nil {
+		cache.files = make(map[string]*file)
+	}
+	cache.files[dir] = f
+	return f, nil
+}
+
+var (
+	sectionRegexp  = regexp.MustCompile(`^\[(.*)\]$`)
+	propertyRegexp = regexp.MustCompile(`^([^=:]*?)[\t ]*[=:][\t ]*(.*)$`)
+)
+
+func parse(name string) (f *file, err error) {
+	r, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := r.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	f = &file{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if m := sectionRegexp.FindStringSubmatch(line); m != nil {
+			pattern, err := glob.Compile(m[1], true)
+			if err != nil {
+				return nil, err
+			}
+			f.sections = append(f.sections, section{pattern, make(map[string]string)})
+			continue
+		}
+		m := propertyRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		key, value := strings.ToLower(m[1]), strings.ToLower(m[2])
+		if len(f.sections) == 0 {
+			if key == "root" {
+				f.root = value == "true"
+			}
+			continue
+		}
+		f.sections[len(f.sections)-1].properties[key] = value
+	}
+	return f, s.Err()
+}
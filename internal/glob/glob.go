@@ -0,0 +1,67 @@
+package glob
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Compile translates a glob in the syntax of .gitignore into a regular
+// expression for slash-separated paths. A glob without a slash matches in any
+// directory, and one with a leading slash only at the top. As in .editorconfig,
+// braces separate alternatives if braces is set.
+func Compile(glob string, braces bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	if strings.HasPrefix(glob, "/") {
+		glob = glob[1:]
+	} else if !strings.Contains(glob, "/") {
+		_, _ = b.WriteString("(?:.*/)?")
+	}
+	depth := 0
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case c == '*':
+			if !strings.HasPrefix(glob[i:], "**") {
+				_, _ = b.WriteString("[^/]*")
+			} else if strings.HasPrefix(glob[i:], "**/") {
+				_, _ = b.WriteString("(?:.*/)?")
+				i += 2
+			} else {
+				_, _ = b.WriteString(".*")
+				i++
+			}
+		case c == '?':
+			_, _ = b.WriteString("[^/]")
+		case c == '[':
+			j := strings.IndexByte(glob[i+1:], ']')
+			if j < 0 {
+				_, _ = b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			_, _ = b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += j + 1
+		case c == '{' && braces:
+			_, _ = b.WriteString("(?:")
+			depth++
+		case c == '}' && braces && depth > 0:
+			_, _ = b.WriteString(")")
+			depth--
+		case c == ',' && depth > 0:
+			_, _ = b.WriteString("|")
+		case c == '\\':
+			if i+1 < len(glob) {
+				i++
+				_, _ = b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			_, _ = b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	for ; depth > 0; depth-- {
+		_, _ = b.WriteString(")")
+	}
+	return regexp.Compile("^" + b.String() + "$")
+}
@@ -0,0 +1,102 @@
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/eisenstatdavid/tools/internal/glob"
+)
+
+type rule struct {
+	pattern         *regexp.Regexp
+	negate, dirOnly bool
+}
+
+// A Matcher holds the patterns of an ignore file, which apply to paths under
+// the directory of the file.
+type Matcher struct {
+	dir   string
+	rules []rule
+}
+
+// Load reads an ignore file in the syntax of .gitignore.
+func Load(name string) (m *Matcher, err error) {
+	dir, err := filepath.Abs(filepath.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	m = &Matcher{dir: dir}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := trimTrailingSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var r rule
+		if line[0] == '!' {
+			r.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if r.pattern, err = glob.Compile(line, false); err != nil {
+			return nil, err
+		}
+		m.rules = append(m.rules, r)
+	}
+	return m, s.Err()
+}
+
+// Match reports whether the file at path is ignored. As in git, a file under an
+// ignored directory stays ignored even if a later pattern negates it.
+func (m *Matcher) Match(path string) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(m.dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		if m.matchOne(strings.Join(parts[:i+1], "/"), i < len(parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Matcher) matchOne(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if (isDir || !r.dirOnly) && r.pattern.MatchString(rel) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+func trimTrailingSpace(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
@@ -0,0 +1,51 @@
+package rewrite
+
+import (
+	"io"
+	"os"
+)
+
+func linkBackup(r *os.File, name string, fs os.FileInfo) error {
+	if backupSuffix == "" {
+		return nil
+	}
+	if err := removeBackup(name); err != nil {
+		return err
+	}
+	if err := os.Link(name, name+backupSuffix); err == nil {
+		return nil
+	}
+	return copyBackup(r, name, fs)
+}
+
+func copyBackup(r *os.File, name string, fs os.FileInfo) (err error) {
+	if backupSuffix == "" {
+		return nil
+	}
+	if err := removeBackup(name); err != nil {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	b, err := os.OpenFile(name+backupSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fs.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := b.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	if _, err := io.Copy(b, r); err != nil {
+		return err
+	}
+	return b.Sync()
+}
+
+func removeBackup(name string) error {
+	if err := os.Remove(name + backupSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package rewrite
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+
+	"github.com/eisenstatdavid/tools/internal/diff"
+)
+
+var (
+	wouldChange atomic.Bool
+	stdout      sync.Mutex
+)
+
+func WouldChange() bool {
+	return wouldChange.Load()
+}
+
+func dryRunFile(name string, w io.Writer, rewrite func(io.Reader, io.Writer) error) (bool, error) {
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		return false, err
+	}
+	var dst bytes.Buffer
+	if err := rewrite(bytes.NewReader(src), &dst); err != nil {
+		return false, err
+	}
+	return printDiff(w, name, src, dst.Bytes())
+}
+
+func printDiff(w io.Writer, name string, src, dst []byte) (bool, error) {
+	if bytes.Equal(src, dst) {
+		return false, nil
+	}
+	wouldChange.Store(true)
+	stdout.Lock()
+	defer stdout.Unlock()
+	return true, diff.Write(w, name, name, src, dst, 3)
+}
@@ -1,44 +1,167 @@
 package rewrite
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"syscall"
+	"time"
 )
 
-func File(name string, rewrite func(io.Reader, io.Writer) error) (err error) {
-	w, err := os.OpenFile(name+"~", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+// File rewrites the named file in place. The diff printed by -diff and the name
+// listed by -l go to out.
+func File(name string, out io.Writer, rewrite func(io.Reader, io.Writer) error) (changed bool, err error) {
+	if dryRun {
+		changed, err = dryRunFile(name, out, rewrite)
+	} else {
+		changed, err = rewriteFile(name, rewrite)
+	}
+	if err == nil && changed {
+		err = report(out, name)
+	}
+	return changed, err
+}
+
+func rewriteFile(name string, rewrite func(io.Reader, io.Writer) error) (changed bool, err error) {
+	name, err = filepath.EvalSymlinks(name)
 	if err != nil {
-		return err
+		return false, err
+	}
+	r, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if cerr := r.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	// Creating a temporary file for unchanged output would still touch the
+	// directory, which file watchers notice.
+	var out bytes.Buffer
+	if err := rewrite(r, &out); err != nil {
+		return false, err
+	}
+	fs, err := r.Stat()
+	if err != nil {
+		return false, err
+	}
+	if same, err := sameContents(r, out.Bytes()); err != nil || same {
+		return false, err
+	}
+	w, err := createTemp(name)
+	if err != nil {
+		return false, err
 	}
 	defer func() {
 		if cerr := w.Close(); cerr != nil && err == nil {
 			err = cerr
 		}
-		if err != nil {
-			_ = os.Remove(w.Name())
+		if err != nil || !changed {
+			discardTemp(w.Name())
 		}
 	}()
-	r, err := os.Open(name)
+	if _, err := w.Write(out.Bytes()); err != nil {
+		return false, err
+	}
+	if st, ok := fs.Sys().(*syscall.Stat_t); ok && st.Nlink > 1 {
+		if err := copyBackup(r, name, fs); err != nil {
+			return false, err
+		}
+		if err := copyBack(w, name); err != nil {
+			return false, err
+		}
+		discardTemp(w.Name())
+		return true, restoreMtime(name, fs)
+	}
+	if err := copyAttrs(r, w, fs); err != nil {
+		return false, err
+	}
+	if err := w.Sync(); err != nil {
+		return false, err
+	}
+	if err := linkBackup(r, name, fs); err != nil {
+		return false, err
+	}
+	if err := renameTemp(w.Name(), name); err != nil {
+		return false, err
+	}
+	return true, restoreMtime(name, fs)
+}
+
+func sameContents(r *os.File, data []byte) (bool, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	b := make([]byte, 1<<15)
+	for {
+		n, err := io.ReadFull(r, b)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return false, err
+		}
+		if n > len(data) || !bytes.Equal(b[:n], data[:n]) {
+			return false, nil
+		}
+		data = data[n:]
+		if err != nil {
+			return len(data) == 0, nil
+		}
+	}
+}
+
+// Renaming over a file with other links would break them, so copy the result
+// back into the original inode instead.
+func copyBack(w *os.File, name string) (err error) {
+	if _, err := w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_TRUNC, 0)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		if cerr := r.Close(); cerr != nil && err == nil {
+		if cerr := f.Close(); cerr != nil && err == nil {
 			err = cerr
 		}
 	}()
-	if err := rewrite(r, w); err != nil {
+	if _, err := io.Copy(f, w); err != nil {
 		return err
 	}
-	fs, err := r.Stat()
-	if err != nil {
-		return err
+	return f.Sync()
+}
+
+func copyAttrs(r, w *os.File, fs os.FileInfo) error {
+	if st, ok := fs.Sys().(*syscall.Stat_t); ok {
+		err := w.Chown(int(st.Uid), int(st.Gid))
+		if errors.Is(err, os.ErrPermission) {
+			err = w.Chown(-1, int(st.Gid))
+		}
+		if err != nil && !errors.Is(err, os.ErrPermission) {
+			return err
+		}
 	}
 	if err := w.Chmod(fs.Mode()); err != nil {
 		return err
 	}
-	if err := w.Sync(); err != nil {
-		return err
+	return copyXattrs(r, w)
+}
+
+func restoreMtime(name string, fs os.FileInfo) error {
+	if !preserveMtime {
+		return nil
+	}
+	return os.Chtimes(name, time.Time{}, fs.ModTime())
+}
+
+func report(w io.Writer, name string) error {
+	if !list {
+		return nil
 	}
-	return os.Rename(w.Name(), name)
+	stdout.Lock()
+	defer stdout.Unlock()
+	_, err := fmt.Fprintln(w, name)
+	return err
 }
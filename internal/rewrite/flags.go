@@ -0,0 +1,15 @@
+package rewrite
+
+import "flag"
+
+var (
+	dryRun, list, preserveMtime bool
+	backupSuffix                string
+)
+
+func Flags() {
+	flag.BoolVar(&dryRun, "diff", false, "print a diff of the changes instead of making them, and exit with a nonzero status if there are any")
+	flag.BoolVar(&list, "l", false, "list the files that were changed")
+	flag.BoolVar(&preserveMtime, "preserve-mtime", false, "keep the modification time of rewritten files")
+	flag.StringVar(&backupSuffix, "backup", "", "keep the original of each rewritten file under its name plus `suffix`")
+}
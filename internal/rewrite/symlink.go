@@ -0,0 +1,34 @@
+package rewrite
+
+import "os"
+
+func Symlink(name, target string) (changed bool, err error) {
+	old, err := os.Readlink(name)
+	if err != nil {
+		return false, err
+	}
+	if dryRun {
+		changed, err = printDiff(os.Stdout, name, []byte(old), []byte(target))
+	} else {
+		changed, err = old != target, nil
+		if changed {
+			err = relink(name, target)
+		}
+	}
+	if err == nil && changed {
+		err = report(os.Stdout, name)
+	}
+	return changed, err
+}
+
+func relink(name, target string) error {
+	temp, err := symlinkTemp(target, name)
+	if err != nil {
+		return err
+	}
+	if err := renameTemp(temp, name); err != nil {
+		discardTemp(temp)
+		return err
+	}
+	return nil
+}
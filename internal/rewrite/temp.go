@@ -0,0 +1,133 @@
+package rewrite
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+var temps struct {
+	sync.Mutex
+	names map[string]bool
+	once  sync.Once
+}
+
+func tempName(name string) string {
+	return filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+"."+strconv.FormatUint(rand.Uint64(), 36)+".tmp")
+}
+
+// Unlike tempName, keep the extension so that tools can detect the language.
+func copyName(name string) string {
+	return filepath.Join(filepath.Dir(name), "."+strconv.FormatUint(rand.Uint64(), 36)+"."+filepath.Base(name))
+}
+
+func createTemp(name string) (*os.File, error) {
+	return createExclusive(tempName, name)
+}
+
+func CreateTemp(name string) (*os.File, error) {
+	return createExclusive(copyName, name)
+}
+
+func RemoveTemp(name string) {
+	discardTemp(name)
+}
+
+func createExclusive(tempName func(string) string, name string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(tempName(name), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		addTemp(f.Name())
+		return f, nil
+	}
+}
+
+func symlinkTemp(target, name string) (string, error) {
+	for {
+		temp := tempName(name)
+		err := os.Symlink(target, temp)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		addTemp(temp)
+		return temp, nil
+	}
+}
+
+func addTemp(name string) {
+	temps.once.Do(removeTempsOnSignal)
+	temps.Lock()
+	defer temps.Unlock()
+	if temps.names == nil {
+		temps.names = make(map[string]bool)
+	}
+	temps.names[name] = true
+}
+
+func discardTemp(name string) {
+	_ = os.Remove(name)
+	removeTemp(name)
+}
+
+func removeTemp(name string) {
+	temps.Lock()
+	defer temps.Unlock()
+	delete(temps.names, name)
+}
+
+// Signals that were ignored when the process started, as under nohup, stay
+// ignored. Exit as a shell reports death by a signal, since the temporary files
+// are gone.
+func removeTempsOnSignal() {
+	c := make(chan os.Signal, 1)
+	for _, sig := range []syscall.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM} {
+		if !signal.Ignored(sig) {
+			signal.Notify(c, sig)
+		}
+	}
+	go func() {
+		sig := <-c
+		temps.Lock()
+		for name := range temps.names {
+			_ = os.Remove(name)
+		}
+		os.Exit(128 + int(sig.(syscall.Signal)))
+	}()
+}
+
+func renameTemp(temp, name string) error {
+	if err := os.Rename(temp, name); err != nil {
+		return err
+	}
+	removeTemp(temp)
+	return syncDir(filepath.Dir(name))
+}
+
+func syncDir(name string) (err error) {
+	d, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := d.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+	return nil
+}
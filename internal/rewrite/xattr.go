@@ -0,0 +1,55 @@
+package rewrite
+
+import (
+	"bytes"
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func copyXattrs(r, w *os.File) error {
+	list, err := readXattr(func(dest []byte) (int, error) {
+		return unix.Flistxattr(int(r.Fd()), dest)
+	})
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil
+		}
+		return err
+	}
+	for _, attr := range bytes.Split(list, []byte{0}) {
+		if len(attr) == 0 {
+			continue
+		}
+		value, err := readXattr(func(dest []byte) (int, error) {
+			return unix.Fgetxattr(int(r.Fd()), string(attr), dest)
+		})
+		if err != nil {
+			return err
+		}
+		if err := unix.Fsetxattr(int(w.Fd()), string(attr), value, 0); err != nil &&
+			!errors.Is(err, unix.ENOTSUP) && !errors.Is(err, os.ErrPermission) {
+			return err
+		}
+	}
+	return nil
+}
+
+func readXattr(read func([]byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := read(nil)
+		if err != nil {
+			return nil, err
+		}
+		dest := make([]byte, size)
+		n, err := read(dest)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return dest[:n], nil
+	}
+}